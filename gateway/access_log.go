@@ -0,0 +1,279 @@
+package gateway
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// accessEntry collects what one client request did; it is filled in as
+// ServeHTTP goes and written once the response is finished.
+type accessEntry struct {
+	Start       time.Time
+	RequestID   string
+	Node        string
+	Attempts    int
+	RetryReason string
+	Upstream    time.Duration
+}
+
+// accessWriter counts status and bytes written to the client.
+type accessWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *accessWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *accessWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.bytes += int64(n)
+	return n, err
+}
+
+func (w *accessWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+type accessLog struct {
+	format   string
+	template string
+	file     *rotatingFile
+}
+
+func newAccessLog(cfg AccessLogConfig) (*accessLog, error) {
+	if cfg.Path == "" {
+		return nil, nil
+	}
+	f, err := openRotatingFile(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("access log: %w", err)
+	}
+	l := &accessLog{format: cfg.Format, file: f}
+	switch cfg.Format {
+	case "common", "combined", "json":
+	default:
+		l.format = "template"
+		l.template = cfg.Format
+	}
+	return l, nil
+}
+
+func (l *accessLog) write(r *http.Request, w *accessWriter, e *accessEntry) {
+	if l == nil {
+		return
+	}
+	vars := accessVars(r, w, e)
+	var line string
+	switch l.format {
+	case "common":
+		line = os.Expand(`${remote_host} - - [${time_clf}] "${request}" ${status} ${bytes_out_clf}`, func(k string) string { return vars[k] })
+	case "combined":
+		line = os.Expand(`${remote_host} - - [${time_clf}] "${request}" ${status} ${bytes_out_clf} "${referer}" "${user_agent}"`, func(k string) string { return vars[k] })
+	case "json":
+		b, err := json.Marshal(accessJSON(r, w, e))
+		if err != nil {
+			Error("access log encode failed", "err", err)
+			return
+		}
+		line = string(b)
+	default:
+		line = os.Expand(l.template, func(k string) string { return vars[k] })
+	}
+	if err := l.file.writeLine(line); err != nil {
+		Error("access log write failed", "path", l.file.path, "err", err)
+	}
+}
+
+func accessVars(r *http.Request, w *accessWriter, e *accessEntry) map[string]string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	bytesOutCLF := "-"
+	if w.bytes > 0 {
+		bytesOutCLF = strconv.FormatInt(w.bytes, 10)
+	}
+	return map[string]string{
+		"remote_addr":         r.RemoteAddr,
+		"remote_host":         host,
+		"time":                e.Start.Format(time.RFC3339),
+		"time_clf":            e.Start.Format("02/Jan/2006:15:04:05 -0700"),
+		"method":              r.Method,
+		"uri":                 r.URL.RequestURI(),
+		"path":                r.URL.Path,
+		"proto":               r.Proto,
+		"request":             r.Method + " " + r.URL.RequestURI() + " " + r.Proto,
+		"status":              strconv.Itoa(w.status),
+		"bytes_in":            strconv.FormatInt(requestBytes(r), 10),
+		"bytes_out":           strconv.FormatInt(w.bytes, 10),
+		"bytes_out_clf":       bytesOutCLF,
+		"referer":             r.Referer(),
+		"user_agent":          r.UserAgent(),
+		"request_id":          e.RequestID,
+		"node":                e.Node,
+		"attempts":            strconv.Itoa(e.Attempts),
+		"retry_reason":        e.RetryReason,
+		"latency_ms":          strconv.FormatInt(time.Since(e.Start).Milliseconds(), 10),
+		"upstream_latency_ms": strconv.FormatInt(e.Upstream.Milliseconds(), 10),
+	}
+}
+
+func accessJSON(r *http.Request, w *accessWriter, e *accessEntry) map[string]interface{} {
+	return map[string]interface{}{
+		"time":                e.Start.Format(time.RFC3339Nano),
+		"remote_addr":         r.RemoteAddr,
+		"method":              r.Method,
+		"uri":                 r.URL.RequestURI(),
+		"proto":               r.Proto,
+		"status":              w.status,
+		"bytes_in":            requestBytes(r),
+		"bytes_out":           w.bytes,
+		"referer":             r.Referer(),
+		"user_agent":          r.UserAgent(),
+		"request_id":          e.RequestID,
+		"node":                e.Node,
+		"attempts":            e.Attempts,
+		"retry_reason":        e.RetryReason,
+		"latency_ms":          time.Since(e.Start).Milliseconds(),
+		"upstream_latency_ms": e.Upstream.Milliseconds(),
+	}
+}
+
+func requestBytes(r *http.Request) int64 {
+	if r.ContentLength > 0 {
+		return r.ContentLength
+	}
+	return 0
+}
+
+// rotatingFile is an append-only file that is renamed to
+// <path>.<timestamp> once it grows past max_size_mb or rotate_interval
+// elapses. Old files beyond max_backups or max_age are removed.
+type rotatingFile struct {
+	path       string
+	maxSize    int64
+	interval   time.Duration
+	maxBackups int
+	maxAge     time.Duration
+
+	mu     sync.Mutex
+	f      *os.File
+	size   int64
+	opened time.Time
+}
+
+func openRotatingFile(cfg AccessLogConfig) (*rotatingFile, error) {
+	rf := &rotatingFile{
+		path:       cfg.Path,
+		maxSize:    int64(cfg.MaxSizeMB) << 20,
+		interval:   cfg.RotateInterval.Duration,
+		maxBackups: cfg.MaxBackups,
+		maxAge:     cfg.MaxAge.Duration,
+	}
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+	return rf, nil
+}
+
+func (rf *rotatingFile) open() error {
+	if dir := filepath.Dir(rf.path); dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+	}
+	f, err := os.OpenFile(rf.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	rf.f = f
+	rf.size = info.Size()
+	rf.opened = time.Now()
+	return nil
+}
+
+func (rf *rotatingFile) writeLine(line string) error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	if rf.needsRotate(int64(len(line)) + 1) {
+		if err := rf.rotate(); err != nil {
+			Error("access log rotate failed", "path", rf.path, "err", err)
+		}
+	}
+	n, err := rf.f.WriteString(line + "\n")
+	rf.size += int64(n)
+	return err
+}
+
+func (rf *rotatingFile) needsRotate(next int64) bool {
+	if rf.maxSize > 0 && rf.size > 0 && rf.size+next > rf.maxSize {
+		return true
+	}
+	return rf.interval > 0 && time.Since(rf.opened) >= rf.interval
+}
+
+// rotate moves the current file aside and starts a new one. When the close
+// or rename fails, the original path is reopened so writes keep going.
+func (rf *rotatingFile) rotate() error {
+	err := rf.f.Close()
+	if err == nil {
+		backup := rf.path + "." + time.Now().Format("20060102-150405.000")
+		err = os.Rename(rf.path, backup)
+	}
+	if openErr := rf.open(); openErr != nil {
+		return errors.Join(err, openErr)
+	}
+	if err != nil {
+		return err
+	}
+	rf.prune()
+	return nil
+}
+
+func (rf *rotatingFile) prune() {
+	matches, err := filepath.Glob(rf.path + ".*")
+	if err != nil {
+		return
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(matches)))
+	for i, m := range matches {
+		if !strings.HasPrefix(filepath.Base(m), filepath.Base(rf.path)+".") {
+			continue
+		}
+		expired := false
+		if rf.maxAge > 0 {
+			if info, err := os.Stat(m); err == nil && time.Since(info.ModTime()) > rf.maxAge {
+				expired = true
+			}
+		}
+		if (rf.maxBackups > 0 && i >= rf.maxBackups) || expired {
+			if err := os.Remove(m); err != nil {
+				Warn("access log prune failed", "path", m, "err", err)
+			}
+		}
+	}
+}
@@ -2,20 +2,28 @@ package gateway
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"os"
+	"strings"
+	"sync"
 )
 
 type AdminHandler struct {
-	cfgPath  string
-	balancer *Balancer
+	cfgPath     string
+	balancer    *Balancer
+	mu          sync.Mutex
+	history     []ConfigVersion
+	lastVersion int
 }
 
 func NewAdminHandler(cfgPath string, balancer *Balancer) *AdminHandler {
-	return &AdminHandler{
+	h := &AdminHandler{
 		cfgPath:  cfgPath,
 		balancer: balancer,
 	}
+	h.loadConfigHistory()
+	return h
 }
 
 func (h *AdminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -23,58 +31,137 @@ func (h *AdminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		http.NotFound(w, r)
 		return
 	}
-	token := h.balancer.config.Gateway.AdminAPIToken
-	if token == "" {
+	if r.URL.Path == "/.krypton/ui" || strings.HasPrefix(r.URL.Path, "/.krypton/ui/") {
+		h.serveUI(w, r)
+		return
+	}
+	tokens := adminTokens(h.balancer.Config().Gateway)
+	if len(tokens) == 0 {
 		http.Error(w, "admin token required", http.StatusForbidden)
 		return
 	}
-	if r.Header.Get("X-Krypton-Token") != token {
+	tok := matchAdminToken(tokens, presentedAdminToken(r))
+	if tok == nil {
 		http.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
+	w.Header().Set("X-Krypton-Token-Name", tok.Name)
+	if scope := requiredScope(r); !tok.allows(scope) {
+		Warn("admin forbidden", "token", tok.Name, "method", r.Method, "path", r.URL.Path, "scope", scope)
+		http.Error(w, "forbidden: "+scope+" scope required", http.StatusForbidden)
+		return
+	}
+	r = withAdminToken(r, tok)
 
 	switch r.URL.Path {
 	case "/.krypton/health":
 		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
 		return
+	case "/.krypton/status":
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		writeJSON(w, http.StatusOK, h.balancer.Status())
+		return
+	case "/.krypton/events":
+		h.serveEvents(w, r)
+		return
 	case "/.krypton/reload/config":
 		if r.Method != http.MethodPost {
 			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
-		if err := h.reloadConfig(); err != nil {
-			Errorf("admin reload config err=%v", err)
+		if queryBool(r, "dry_run") {
+			h.serveConfigPlan(w, r)
+			return
+		}
+		changes, err := h.reloadConfig(r)
+		h.audit(r, "reload_config", h.cfgPath, changes, err)
+		if err != nil {
+			Error("admin reload config failed", "err", err)
+			var verr *configValidationError
+			if errors.As(err, &verr) {
+				writeJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{"status": "error", "message": "invalid config", "errors": verr.Errors})
+				return
+			}
 			writeJSON(w, http.StatusInternalServerError, map[string]string{"status": "error", "message": err.Error()})
 			return
 		}
-		Infof("admin reload config ok")
-		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+		Info("admin reload config ok", "changes", len(changes))
+		writeJSON(w, http.StatusOK, map[string]interface{}{"status": "ok", "changes": changes, "warnings": restartWarnings(changes)})
+		return
+	case "/.krypton/config/validate":
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.serveConfigPlan(w, r)
+		return
+	case "/.krypton/config/history":
+		h.serveConfigHistory(w, r)
 		return
 	case "/.krypton/reload/scripts":
 		if r.Method != http.MethodPost {
 			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
-		if err := h.validateScripts(); err != nil {
-			Errorf("admin reload scripts err=%v", err)
+		err := h.validateScripts()
+		h.audit(r, "reload_scripts", "", nil, err)
+		if err != nil {
+			Error("admin reload scripts failed", "err", err)
 			writeJSON(w, http.StatusInternalServerError, map[string]string{"status": "error", "message": err.Error()})
 			return
 		}
-		Infof("admin reload scripts ok")
+		Info("admin reload scripts ok")
 		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
 		return
+	case "/.krypton/scripts/health/test":
+		h.testHealthScript(w, r)
+		return
+	case "/.krypton/scripts/trigger/test":
+		h.testTriggerScript(w, r)
+		return
+	case "/.krypton/metrics", "/metrics":
+		h.serveMetrics(w, r)
+		return
+	case "/.krypton/log/level":
+		h.serveLogLevel(w, r)
+		return
+	case "/.krypton/nodes":
+		h.serveNodes(w, r, "")
+		return
 	default:
+		if id, ok := strings.CutPrefix(r.URL.Path, "/.krypton/nodes/"); ok && id != "" {
+			h.serveNodes(w, r, id)
+			return
+		}
+		if version, ok := strings.CutPrefix(r.URL.Path, "/.krypton/config/rollback/"); ok && version != "" {
+			h.serveConfigRollback(w, r, version)
+			return
+		}
 		http.NotFound(w, r)
 		return
 	}
 }
 
-func (h *AdminHandler) reloadConfig() error {
+func (h *AdminHandler) reloadConfig(r *http.Request) ([]ConfigChange, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
 	cfg, err := LoadConfig(h.cfgPath)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if errs := validateConfig(cfg); len(errs) > 0 {
+		return nil, &configValidationError{Errors: errs}
+	}
+	before := h.balancer.Config()
+	if err := h.balancer.ApplyConfig(cfg); err != nil {
+		return nil, err
 	}
-	return h.balancer.ApplyConfig(cfg)
+	after := h.balancer.Config()
+	h.recordHistoryLocked(r, "reload_config", &before, &after)
+	return diffConfig(&before, &after), nil
 }
 
 func (h *AdminHandler) validateScripts() error {
@@ -0,0 +1,123 @@
+package gateway
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const (
+	scopeRead   = "read"
+	scopeWrite  = "write"
+	scopeConfig = "config"
+)
+
+type adminTokenKey struct{}
+
+type adminToken struct {
+	Name   string
+	Scopes []string
+}
+
+func (t *adminToken) allows(scope string) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// adminTokens returns the configured tokens. The legacy admin_api_token is
+// kept as a token named "default" that carries every scope.
+func adminTokens(gw GatewayConfig) []AdminTokenConfig {
+	tokens := make([]AdminTokenConfig, 0, len(gw.AdminTokens)+1)
+	if gw.AdminAPIToken != "" {
+		tokens = append(tokens, AdminTokenConfig{
+			Name:   "default",
+			Token:  gw.AdminAPIToken,
+			Scopes: []string{scopeRead, scopeWrite, scopeConfig},
+		})
+	}
+	for i, t := range gw.AdminTokens {
+		if t.Token == "" {
+			continue
+		}
+		if t.Name == "" {
+			t.Name = fmt.Sprintf("token-%d", i+1)
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens
+}
+
+// matchAdminToken compares the presented secret against every configured
+// token. Both sides are hashed first so the comparison time depends on
+// neither the secret length nor which token matched.
+func matchAdminToken(tokens []AdminTokenConfig, presented string) *adminToken {
+	if presented == "" {
+		return nil
+	}
+	sum := sha256.Sum256([]byte(presented))
+	var match *adminToken
+	for _, t := range tokens {
+		want := sha256.Sum256([]byte(t.Token))
+		if subtle.ConstantTimeCompare(sum[:], want[:]) == 1 && match == nil {
+			match = &adminToken{Name: t.Name, Scopes: t.Scopes}
+		}
+	}
+	return match
+}
+
+func presentedAdminToken(r *http.Request) string {
+	if v := r.Header.Get("X-Krypton-Token"); v != "" {
+		return v
+	}
+	if v, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(v)
+	}
+	return ""
+}
+
+// requiredScope maps an admin request to the scope it needs: reads need
+// read, runtime node actions need write, and anything that changes or
+// reloads configuration needs config.
+func requiredScope(r *http.Request) string {
+	path := r.URL.Path
+	if strings.HasPrefix(path, "/.krypton/reload/") {
+		return scopeConfig
+	}
+	if strings.HasPrefix(path, "/.krypton/config/") {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			return scopeRead
+		}
+		return scopeConfig
+	}
+	if rest, ok := strings.CutPrefix(path, "/.krypton/nodes"); ok {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			return scopeRead
+		}
+		if strings.Contains(strings.TrimPrefix(rest, "/"), "/") {
+			return scopeWrite
+		}
+		return scopeConfig
+	}
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		return scopeRead
+	}
+	return scopeWrite
+}
+
+func withAdminToken(r *http.Request, tok *adminToken) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), adminTokenKey{}, tok))
+}
+
+func adminTokenName(r *http.Request) string {
+	if tok, ok := r.Context().Value(adminTokenKey{}).(*adminToken); ok && tok != nil {
+		return tok.Name
+	}
+	return ""
+}
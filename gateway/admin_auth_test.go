@@ -0,0 +1,110 @@
+package gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequiredScope(t *testing.T) {
+	tests := []struct {
+		method, path string
+		want         string
+	}{
+		{http.MethodGet, "/.krypton/status", scopeRead},
+		{http.MethodHead, "/.krypton/status", scopeRead},
+		{http.MethodGet, "/.krypton/events", scopeRead},
+		{http.MethodGet, "/.krypton/config/history", scopeRead},
+		{http.MethodPost, "/.krypton/config/rollback/3", scopeConfig},
+		{http.MethodPost, "/.krypton/config/validate", scopeConfig},
+		{http.MethodPost, "/.krypton/reload/config", scopeConfig},
+		{http.MethodPost, "/.krypton/reload/scripts", scopeConfig},
+		{http.MethodGet, "/.krypton/nodes", scopeRead},
+		{http.MethodGet, "/.krypton/nodes/srv-1", scopeRead},
+		{http.MethodGet, "/.krypton/nodes/srv-1/health", scopeRead},
+		{http.MethodPost, "/.krypton/nodes", scopeConfig},
+		{http.MethodPut, "/.krypton/nodes/srv-1", scopeConfig},
+		{http.MethodDelete, "/.krypton/nodes/srv-1", scopeConfig},
+		{http.MethodPost, "/.krypton/nodes/srv-1/drain", scopeWrite},
+		{http.MethodPost, "/.krypton/nodes/srv-1/disable", scopeWrite},
+		{http.MethodPost, "/.krypton/nodes/srv-1/override", scopeWrite},
+		{http.MethodDelete, "/.krypton/nodes/srv-1/override", scopeWrite},
+		{http.MethodPut, "/.krypton/log/level", scopeWrite},
+		{http.MethodPost, "/.krypton/scripts/trigger/test", scopeWrite},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, tt.path, nil)
+		if got := requiredScope(r); got != tt.want {
+			t.Errorf("%s %s: scope = %q, want %q", tt.method, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestAdminTokenScopes(t *testing.T) {
+	cfg := &Config{Nodes: []NodeConfig{{ID: "srv-1", Address: "http://127.0.0.1:9001", Weight: 100}}}
+	cfg.Gateway.Shards = 1
+	cfg.Gateway.AdminAPIEnabled = true
+	cfg.Gateway.AdminAPIToken = "legacy"
+	cfg.Gateway.AdminTokens = []AdminTokenConfig{
+		{Name: "viewer", Token: "ro", Scopes: []string{scopeRead}},
+		{Name: "ops", Token: "rw", Scopes: []string{scopeRead, scopeWrite}},
+		{Name: "deployer", Token: "cfg", Scopes: []string{scopeConfig}},
+	}
+	b, err := NewBalancer(cfg)
+	if err != nil {
+		t.Fatalf("NewBalancer: %v", err)
+	}
+	h := NewAdminHandler(t.TempDir()+"/config.toml", b)
+
+	const (
+		allowed      = 0
+		unauthorized = http.StatusUnauthorized
+		forbidden    = http.StatusForbidden
+	)
+	tests := []struct {
+		name         string
+		token        string
+		bearer       bool
+		method, path string
+		want         int
+	}{
+		{"no token", "", false, http.MethodGet, "/.krypton/status", unauthorized},
+		{"wrong token", "nope", false, http.MethodGet, "/.krypton/status", unauthorized},
+		{"token prefix", "r", false, http.MethodGet, "/.krypton/status", unauthorized},
+		{"read with read", "ro", false, http.MethodGet, "/.krypton/status", allowed},
+		{"read via bearer", "ro", true, http.MethodGet, "/.krypton/status", allowed},
+		{"write with read", "ro", false, http.MethodPost, "/.krypton/nodes/srv-1/disable", forbidden},
+		{"config with read", "ro", false, http.MethodPost, "/.krypton/reload/config", forbidden},
+		{"write with write", "rw", false, http.MethodPost, "/.krypton/nodes/srv-1/disable", allowed},
+		{"config with write", "rw", false, http.MethodDelete, "/.krypton/nodes/srv-1", forbidden},
+		{"rollback with write", "rw", false, http.MethodPost, "/.krypton/config/rollback/1", forbidden},
+		{"config with config", "cfg", false, http.MethodPost, "/.krypton/reload/config", allowed},
+		{"read with config only", "cfg", false, http.MethodGet, "/.krypton/status", forbidden},
+		{"legacy token has every scope", "legacy", false, http.MethodPost, "/.krypton/reload/config", allowed},
+		{"legacy token reads", "legacy", true, http.MethodGet, "/.krypton/nodes", allowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.token != "" {
+				if tt.bearer {
+					r.Header.Set("Authorization", "Bearer "+tt.token)
+				} else {
+					r.Header.Set("X-Krypton-Token", tt.token)
+				}
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			switch tt.want {
+			case allowed:
+				if w.Code == unauthorized || w.Code == forbidden {
+					t.Errorf("status = %d, want the request to pass auth", w.Code)
+				}
+			default:
+				if w.Code != tt.want {
+					t.Errorf("status = %d, want %d", w.Code, tt.want)
+				}
+			}
+		})
+	}
+}
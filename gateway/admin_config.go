@@ -0,0 +1,42 @@
+package gateway
+
+import (
+	"net/http"
+)
+
+type configPlan struct {
+	Status   string         `json:"status"`
+	Path     string         `json:"path"`
+	Valid    bool           `json:"valid"`
+	Errors   []string       `json:"errors"`
+	Warnings []string       `json:"warnings"`
+	Changes  []ConfigChange `json:"changes"`
+}
+
+// serveConfigPlan loads the config file, validates it and diffs it against
+// the running config without applying anything.
+func (h *AdminHandler) serveConfigPlan(w http.ResponseWriter, r *http.Request) {
+	plan := configPlan{
+		Status:  "ok",
+		Path:    h.cfgPath,
+		Errors:  []string{},
+		Changes: []ConfigChange{},
+	}
+	next, err := LoadConfig(h.cfgPath)
+	if err != nil {
+		plan.Status = "invalid"
+		plan.Errors = append(plan.Errors, err.Error())
+		plan.Warnings = []string{}
+		writeJSON(w, http.StatusOK, plan)
+		return
+	}
+	plan.Errors = append(plan.Errors, validateConfig(next)...)
+	running := h.balancer.Config()
+	plan.Changes = diffConfig(&running, next)
+	plan.Warnings = restartWarnings(plan.Changes)
+	plan.Valid = len(plan.Errors) == 0
+	if !plan.Valid {
+		plan.Status = "invalid"
+	}
+	writeJSON(w, http.StatusOK, plan)
+}
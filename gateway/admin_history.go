@@ -0,0 +1,187 @@
+package gateway
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultConfigHistoryLimit = 20
+
+// ConfigVersion is the config that was running before an admin change
+// replaced it. Rolling back to a version re-applies that config.
+type ConfigVersion struct {
+	Version int            `json:"version"`
+	Time    time.Time      `json:"time"`
+	Action  string         `json:"action"`
+	Token   string         `json:"token,omitempty"`
+	Changes []ConfigChange `json:"changes"`
+	config  Config
+}
+
+// loadConfigHistory restores snapshots left in admin_config_history_dir by a
+// previous run. Their metadata is not kept, so they are listed as restored.
+func (h *AdminHandler) loadConfigHistory() {
+	dir := h.balancer.Config().Gateway.AdminConfigHistoryDir
+	if dir == "" {
+		return
+	}
+	matches, err := filepath.Glob(filepath.Join(dir, "config.v*.toml"))
+	if err != nil {
+		return
+	}
+	for _, path := range matches {
+		num := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), "config.v"), ".toml")
+		version, err := strconv.Atoi(num)
+		if err != nil {
+			continue
+		}
+		cfg, err := LoadConfig(path)
+		if err != nil {
+			Warn("config history skip", "path", path, "err", err)
+			continue
+		}
+		v := ConfigVersion{Version: version, Action: "restored", Changes: []ConfigChange{}, config: *cfg}
+		if st, err := os.Stat(path); err == nil {
+			v.Time = st.ModTime()
+		}
+		h.history = append(h.history, v)
+		if version > h.lastVersion {
+			h.lastVersion = version
+		}
+	}
+	sort.Slice(h.history, func(i, j int) bool { return h.history[i].Version < h.history[j].Version })
+	h.trimHistoryLocked()
+}
+
+// recordHistoryLocked keeps before as a new version, unless nothing changed
+// so that no-op reloads do not push real versions out of the limit. h.mu
+// must be held.
+func (h *AdminHandler) recordHistoryLocked(r *http.Request, action string, before, after *Config) {
+	changes := diffConfig(before, after)
+	if len(changes) == 0 {
+		return
+	}
+	h.lastVersion++
+	v := ConfigVersion{
+		Version: h.lastVersion,
+		Time:    time.Now(),
+		Action:  action,
+		Token:   adminTokenName(r),
+		Changes: changes,
+		config:  *before,
+	}
+	v.config.Nodes = append([]NodeConfig(nil), before.Nodes...)
+	h.history = append(h.history, v)
+	if dir := after.Gateway.AdminConfigHistoryDir; dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			Error("config history mkdir failed", "dir", dir, "err", err)
+		} else if err := SaveConfig(historyPath(dir, v.Version), &v.config); err != nil {
+			Error("config history save failed", "version", v.Version, "err", err)
+		}
+	}
+	h.trimHistoryLocked()
+}
+
+func (h *AdminHandler) trimHistoryLocked() {
+	gw := h.balancer.Config().Gateway
+	limit := gw.AdminConfigHistoryLimit
+	if limit <= 0 {
+		limit = defaultConfigHistoryLimit
+	}
+	for len(h.history) > limit {
+		old := h.history[0]
+		h.history = h.history[1:]
+		if gw.AdminConfigHistoryDir != "" {
+			_ = os.Remove(historyPath(gw.AdminConfigHistoryDir, old.Version))
+		}
+	}
+}
+
+func historyPath(dir string, version int) string {
+	return filepath.Join(dir, fmt.Sprintf("config.v%d.toml", version))
+}
+
+func (h *AdminHandler) serveConfigHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	h.mu.Lock()
+	versions := append([]ConfigVersion{}, h.history...)
+	h.mu.Unlock()
+	// newest first
+	for i, j := 0, len(versions)-1; i < j; i, j = i+1, j-1 {
+		versions[i], versions[j] = versions[j], versions[i]
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"status": "ok", "versions": versions})
+}
+
+// serveConfigRollback re-applies a stored version and writes it back to the
+// config file so the next reload or restart does not bring back the config
+// that was rolled back. The config being replaced is itself kept as a new
+// version, so a rollback can be undone.
+func (h *AdminHandler) serveConfigRollback(w http.ResponseWriter, r *http.Request, raw string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	version, err := strconv.Atoi(raw)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"status": "error", "message": "invalid version"})
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var target *Config
+	for i := range h.history {
+		if h.history[i].Version == version {
+			cfg := h.history[i].config
+			cfg.Nodes = append([]NodeConfig(nil), cfg.Nodes...)
+			target = &cfg
+			break
+		}
+	}
+	if target == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"status": "error", "message": "version not found"})
+		return
+	}
+
+	before := h.balancer.Config()
+	target.Gateway.AdminConfigHistoryDir = before.Gateway.AdminConfigHistoryDir
+	target.Gateway.AdminConfigHistoryLimit = before.Gateway.AdminConfigHistoryLimit
+	if errs := validateConfig(target); len(errs) > 0 {
+		err := &configValidationError{Errors: errs}
+		h.audit(r, "config_rollback", raw, nil, err)
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{"status": "error", "message": "invalid config", "errors": errs})
+		return
+	}
+	err = h.balancer.ApplyConfig(target)
+	after := h.balancer.Config()
+	changes := diffConfig(&before, &after)
+	h.audit(r, "config_rollback", raw, changes, err)
+	if err != nil {
+		Error("admin config rollback failed", "version", version, "err", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"status": "error", "message": err.Error()})
+		return
+	}
+	h.recordHistoryLocked(r, fmt.Sprintf("rollback_to_v%d", version), &before, &after)
+	if err := SaveConfig(h.cfgPath, &after); err != nil {
+		Error("admin config rollback persist failed", "version", version, "err", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"status": "error", "message": fmt.Sprintf("applied but not persisted: %v", err)})
+		return
+	}
+	Info("admin config rollback ok", "version", version, "changes", len(changes))
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status":   "ok",
+		"version":  version,
+		"changes":  changes,
+		"warnings": restartWarnings(changes),
+	})
+}
@@ -0,0 +1,80 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+const defaultDebugScopeTTL = 10 * time.Minute
+
+type logLevelRequest struct {
+	Level string `json:"level"`
+	Node  string `json:"node"`
+	Path  string `json:"path"`
+	TTL   string `json:"ttl"`
+}
+
+func (h *AdminHandler) serveLogLevel(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeLogLevel(w)
+	case http.MethodPut:
+		var req logLevelRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"status": "error", "message": "invalid body: " + err.Error()})
+			return
+		}
+		if req.Node == "" && req.Path == "" {
+			level, ok := ParseLogLevel(req.Level)
+			if !ok {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"status": "error", "message": "level must be one of debug, info, warn, error"})
+				return
+			}
+			before := GetLogLevel()
+			SetLogLevel(level)
+			h.audit(r, "log_level", "", []ConfigChange{{Field: "level", Before: before.String(), After: level.String()}}, nil)
+			logAlways("admin log level changed", "level", level.String(), "token", adminTokenName(r))
+			writeLogLevel(w)
+			return
+		}
+		if level, ok := ParseLogLevel(req.Level); req.Level != "" && (!ok || level != LevelDebug) {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"status": "error", "message": "only debug can be scoped to a node or path"})
+			return
+		}
+		ttl := defaultDebugScopeTTL
+		if req.TTL != "" {
+			d, err := time.ParseDuration(req.TTL)
+			if err != nil || d <= 0 {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"status": "error", "message": "ttl must be a positive duration"})
+				return
+			}
+			ttl = d
+		}
+		if req.Node != "" && h.balancer.Node(req.Node) == nil {
+			writeJSON(w, http.StatusNotFound, map[string]string{"status": "error", "message": "node not found"})
+			return
+		}
+		scope := DebugScope{Node: req.Node, Path: req.Path, Expires: time.Now().Add(ttl)}
+		AddDebugScope(scope)
+		h.audit(r, "log_debug_scope", req.Node+req.Path, []ConfigChange{{Field: "debug_scope", After: scope}}, nil)
+		logAlways("admin debug scope added", "scope_node", req.Node, "scope_path", req.Path, "ttl", ttl, "token", adminTokenName(r))
+		writeLogLevel(w)
+	case http.MethodDelete:
+		before := DebugScopes()
+		ClearDebugScopes()
+		h.audit(r, "log_debug_scope_clear", "", []ConfigChange{{Field: "debug_scope", Before: before}}, nil)
+		Info("admin debug scopes cleared", "count", len(before))
+		writeLogLevel(w)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func writeLogLevel(w http.ResponseWriter) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status": "ok",
+		"level":  GetLogLevel().String(),
+		"scopes": DebugScopes(),
+	})
+}
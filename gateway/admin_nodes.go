@@ -0,0 +1,282 @@
+package gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+type nodeUpdate struct {
+	Weight      *int32  `json:"weight"`
+	CheckScript *string `json:"check_script"`
+}
+
+func (h *AdminHandler) serveNodes(w http.ResponseWriter, r *http.Request, id string) {
+	if id == "" {
+		switch r.Method {
+		case http.MethodGet:
+			cfg := h.balancer.Config()
+			writeJSON(w, http.StatusOK, map[string]interface{}{"status": "ok", "nodes": cfg.Nodes})
+		case http.MethodPost:
+			h.addNode(w, r)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	if id, action, ok := strings.Cut(id, "/"); ok {
+		h.serveNodeAction(w, r, id, action)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		cfg := h.balancer.Config()
+		for _, nc := range cfg.Nodes {
+			if nc.ID == id {
+				writeJSON(w, http.StatusOK, map[string]interface{}{"status": "ok", "node": nc})
+				return
+			}
+		}
+		writeJSON(w, http.StatusNotFound, map[string]string{"status": "error", "message": "node not found"})
+	case http.MethodPut:
+		h.updateNode(w, r, id)
+	case http.MethodDelete:
+		h.removeNode(w, r, id)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *AdminHandler) addNode(w http.ResponseWriter, r *http.Request) {
+	var nc NodeConfig
+	if err := json.NewDecoder(r.Body).Decode(&nc); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"status": "error", "message": "invalid body: " + err.Error()})
+		return
+	}
+	if err := validateNodeConfig(nc); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"status": "error", "message": err.Error()})
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	nodes := h.balancer.Config().Nodes
+	for _, existing := range nodes {
+		if existing.ID == nc.ID {
+			writeJSON(w, http.StatusConflict, map[string]string{"status": "error", "message": "node already exists"})
+			return
+		}
+	}
+	nodes = append(nodes, nc)
+	if !h.applyNodes(w, r, nodes, "add", nc.ID) {
+		return
+	}
+	writeJSON(w, http.StatusCreated, map[string]interface{}{"status": "ok", "node": nc})
+}
+
+func (h *AdminHandler) updateNode(w http.ResponseWriter, r *http.Request, id string) {
+	var upd nodeUpdate
+	if err := json.NewDecoder(r.Body).Decode(&upd); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"status": "error", "message": "invalid body: " + err.Error()})
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	nodes := h.balancer.Config().Nodes
+	idx := -1
+	for i, nc := range nodes {
+		if nc.ID == id {
+			idx = i
+			break
+		}
+	}
+	if idx < 0 {
+		writeJSON(w, http.StatusNotFound, map[string]string{"status": "error", "message": "node not found"})
+		return
+	}
+	if upd.Weight != nil {
+		nodes[idx].Weight = *upd.Weight
+	}
+	if upd.CheckScript != nil {
+		nodes[idx].CheckScript = *upd.CheckScript
+	}
+	if err := validateNodeConfig(nodes[idx]); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"status": "error", "message": err.Error()})
+		return
+	}
+	if !h.applyNodes(w, r, nodes, "update", id) {
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"status": "ok", "node": nodes[idx]})
+}
+
+func (h *AdminHandler) removeNode(w http.ResponseWriter, r *http.Request, id string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	nodes := h.balancer.Config().Nodes
+	next := make([]NodeConfig, 0, len(nodes))
+	for _, nc := range nodes {
+		if nc.ID != id {
+			next = append(next, nc)
+		}
+	}
+	if len(next) == len(nodes) {
+		writeJSON(w, http.StatusNotFound, map[string]string{"status": "error", "message": "node not found"})
+		return
+	}
+	if !h.applyNodes(w, r, next, "remove", id) {
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func (h *AdminHandler) serveNodeAction(w http.ResponseWriter, r *http.Request, id, action string) {
+	node := h.balancer.Node(id)
+	if node == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"status": "error", "message": "node not found"})
+		return
+	}
+	if action == "override" {
+		h.serveOverride(w, r, node)
+		return
+	}
+	if action == "health" {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"status": "ok", "id": id, "history": node.history.List()})
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	before := node.State()
+	switch action {
+	case "drain":
+		if node.State() == NodeEnabled {
+			node.Drain()
+		}
+	case "disable":
+		node.SetState(NodeDisabled)
+	case "enable":
+		node.SetState(NodeEnabled)
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	h.audit(r, "node_"+action, id, []ConfigChange{{Field: "state", Before: before.String(), After: node.State().String()}}, nil)
+	Info("admin node "+action, "node", id, "state", node.State().String(), "inflight", atomic.LoadInt32(&node.inflight))
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status":   "ok",
+		"id":       id,
+		"state":    node.State().String(),
+		"inflight": atomic.LoadInt32(&node.inflight),
+	})
+}
+
+type overrideRequest struct {
+	PassiveScore    *int32 `json:"passive_score"`
+	ActiveScore     *int32 `json:"active_score"`
+	EffectiveWeight *int32 `json:"effective_weight"`
+	TTL             string `json:"ttl"`
+}
+
+func (h *AdminHandler) serveOverride(w http.ResponseWriter, r *http.Request, node *Node) {
+	switch r.Method {
+	case http.MethodPost:
+		var req overrideRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"status": "error", "message": "invalid body: " + err.Error()})
+			return
+		}
+		if req.PassiveScore == nil && req.ActiveScore == nil && req.EffectiveWeight == nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"status": "error", "message": "one of passive_score, active_score or effective_weight required"})
+			return
+		}
+		ttl, err := time.ParseDuration(req.TTL)
+		if err != nil || ttl <= 0 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"status": "error", "message": "ttl must be a positive duration"})
+			return
+		}
+		o := &ScoreOverride{
+			PassiveScore:    clampScorePtr(req.PassiveScore),
+			ActiveScore:     clampScorePtr(req.ActiveScore),
+			EffectiveWeight: req.EffectiveWeight,
+			Expires:         time.Now().Add(ttl),
+		}
+		before := node.Override()
+		node.SetOverride(o)
+		h.audit(r, "node_override", node.ID, []ConfigChange{{Field: "override", Before: before, After: o}}, nil)
+		Info("admin node override", "node", node.ID, "ttl", ttl)
+		writeJSON(w, http.StatusOK, map[string]interface{}{"status": "ok", "id": node.ID, "override": o})
+	case http.MethodDelete:
+		before := node.Override()
+		if !node.ClearOverride() {
+			writeJSON(w, http.StatusNotFound, map[string]string{"status": "error", "message": "no active override"})
+			return
+		}
+		h.audit(r, "node_override_clear", node.ID, []ConfigChange{{Field: "override", Before: before, After: nil}}, nil)
+		Info("admin node override cleared", "node", node.ID)
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func clampScorePtr(v *int32) *int32 {
+	if v == nil {
+		return nil
+	}
+	s := *v
+	if s < 0 {
+		s = 0
+	}
+	if s > 100 {
+		s = 100
+	}
+	return &s
+}
+
+// applyNodes swaps in the new node list and, when ?persist=1 is given, writes
+// the running config back to the config file. It writes the error response
+// itself and reports whether the caller should continue.
+func (h *AdminHandler) applyNodes(w http.ResponseWriter, r *http.Request, nodes []NodeConfig, action, id string) bool {
+	before := h.balancer.Config()
+	err := h.balancer.ApplyNodes(nodes)
+	h.audit(r, "node_"+action, id, diffNodes(before.Nodes, nodes), err)
+	if err != nil {
+		Error("admin node "+action+" failed", "node", id, "err", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"status": "error", "message": err.Error()})
+		return false
+	}
+	Info("admin node "+action+" ok", "node", id)
+	cfg := h.balancer.Config()
+	h.recordHistoryLocked(r, "node_"+action, &before, &cfg)
+	if !queryBool(r, "persist") {
+		return true
+	}
+	if err := SaveConfig(h.cfgPath, &cfg); err != nil {
+		Error("admin node "+action+" persist failed", "node", id, "err", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"status": "error", "message": fmt.Sprintf("applied but not persisted: %v", err)})
+		return false
+	}
+	Info("admin node "+action+" persisted", "node", id, "path", h.cfgPath)
+	return true
+}
+
+func queryBool(r *http.Request, key string) bool {
+	switch r.URL.Query().Get(key) {
+	case "1", "true", "yes":
+		return true
+	default:
+		return false
+	}
+}
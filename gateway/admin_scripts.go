@@ -0,0 +1,112 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+type scriptTestResponse struct {
+	Status     string          `json:"status"`
+	Node       string          `json:"node"`
+	Script     string          `json:"script"`
+	Result     interface{}     `json:"result"`
+	Error      string          `json:"error,omitempty"`
+	DurationMs int64           `json:"duration_ms"`
+	Logs       []ScriptLogLine `json:"logs"`
+}
+
+// testHealthScript runs the node's check() once and reports the parsed
+// result without touching the node's scores.
+func (h *AdminHandler) testHealthScript(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id := r.URL.Query().Get("node")
+	node := h.balancer.Node(id)
+	if node == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"status": "error", "message": "node not found"})
+		return
+	}
+	cfg := h.balancer.Config()
+	checkCfg := healthCheckConfigFor(&cfg, node)
+
+	logs := &scriptLog{}
+	ctx := withScriptLog(r.Context(), logs)
+	start := time.Now()
+	result, err := runStarlarkCheck(ctx, checkCfg, node, &cfg)
+	resp := scriptTestResponse{
+		Status:     "ok",
+		Node:       node.ID,
+		Script:     checkCfg.Script,
+		Result:     result,
+		DurationMs: time.Since(start).Milliseconds(),
+		Logs:       logs.Lines(),
+	}
+	if err != nil {
+		resp.Status = "error"
+		resp.Error = err.Error()
+	}
+	Info("admin health script test", "node", node.ID, "script", checkCfg.Script, "score", result.Score, "err", err)
+	writeJSON(w, http.StatusOK, resp)
+}
+
+type triggerTestRequest struct {
+	Node     string          `json:"node"`
+	Request  triggerRequest  `json:"request"`
+	Response triggerResponse `json:"response"`
+}
+
+// testTriggerScript runs trigger() against a synthetic request/response pair
+// and returns the parsed result without changing any node scores. Only the
+// configured trigger_script is run.
+func (h *AdminHandler) testTriggerScript(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req triggerTestRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"status": "error", "message": "invalid body: " + err.Error()})
+		return
+	}
+	node := h.balancer.Node(req.Node)
+	if node == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"status": "error", "message": "node not found"})
+		return
+	}
+	cfg := h.balancer.Config()
+	if cfg.Gateway.TriggerScript == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"status": "error", "message": "no trigger script configured"})
+		return
+	}
+	if req.Request.Method == "" {
+		req.Request.Method = http.MethodGet
+	}
+	if req.Request.Headers == nil {
+		req.Request.Headers = map[string]string{}
+	}
+	if req.Response.Status == 0 {
+		req.Response.Status = http.StatusOK
+	}
+
+	logs := &scriptLog{}
+	ctx := withScriptLog(r.Context(), logs)
+	start := time.Now()
+	result, err := runTrigger(ctx, &cfg, node, &req.Request, &req.Response)
+	resp := scriptTestResponse{
+		Status:     "ok",
+		Node:       node.ID,
+		Script:     cfg.Gateway.TriggerScript,
+		Result:     result,
+		DurationMs: time.Since(start).Milliseconds(),
+		Logs:       logs.Lines(),
+	}
+	if err != nil {
+		resp.Status = "error"
+		resp.Error = err.Error()
+	}
+	Info("admin trigger script test", "node", node.ID, "script", cfg.Gateway.TriggerScript, "err", err)
+	writeJSON(w, http.StatusOK, resp)
+}
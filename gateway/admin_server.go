@@ -0,0 +1,70 @@
+package gateway
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+// NewAdminServer builds the dedicated admin listener configured by
+// admin_listen. When admin_client_ca is set, clients must present a
+// certificate signed by one of the CAs in the bundle.
+func NewAdminServer(cfg *Config, admin http.Handler) (*http.Server, error) {
+	gw := cfg.Gateway
+	mux := http.NewServeMux()
+	mux.Handle("/.krypton/", admin)
+	mux.Handle("/metrics", admin)
+
+	server := &http.Server{
+		Addr:              gw.AdminListen,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       gw.ReadTimeout.Duration,
+		WriteTimeout:      gw.WriteTimeout.Duration,
+		IdleTimeout:       gw.IdleTimeout.Duration,
+	}
+
+	if gw.AdminTLSCert == "" && gw.AdminTLSKey == "" {
+		if gw.AdminClientCA != "" {
+			return nil, errors.New("admin_client_ca requires admin_tls_cert and admin_tls_key")
+		}
+		return server, nil
+	}
+	if gw.AdminTLSCert == "" || gw.AdminTLSKey == "" {
+		return nil, errors.New("admin_tls_cert and admin_tls_key must be set together")
+	}
+	cert, err := tls.LoadX509KeyPair(gw.AdminTLSCert, gw.AdminTLSKey)
+	if err != nil {
+		return nil, fmt.Errorf("admin tls keypair: %w", err)
+	}
+	tlsCfg := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+	}
+	if gw.AdminClientCA != "" {
+		pem, err := os.ReadFile(gw.AdminClientCA)
+		if err != nil {
+			return nil, fmt.Errorf("admin client ca: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("admin client ca: no certificates found in %s", gw.AdminClientCA)
+		}
+		tlsCfg.ClientCAs = pool
+		tlsCfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	server.TLSConfig = tlsCfg
+	return server, nil
+}
+
+func ServeAdmin(server *http.Server, ln net.Listener) error {
+	if server.TLSConfig != nil {
+		return server.ServeTLS(ln, "", "")
+	}
+	return server.Serve(ln)
+}
@@ -0,0 +1,92 @@
+package gateway
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"time"
+)
+
+//go:embed ui
+var uiFiles embed.FS
+
+const uiStatusInterval = 2 * time.Second
+
+// serveUI serves the embedded dashboard. The static files carry no data and
+// are served without a token; the page authenticates its API calls itself.
+func (h *AdminHandler) serveUI(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/.krypton/ui" {
+		http.Redirect(w, r, "/.krypton/ui/", http.StatusMovedPermanently)
+		return
+	}
+	sub, err := fs.Sub(uiFiles, "ui")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.StripPrefix("/.krypton/ui/", http.FileServer(http.FS(sub))).ServeHTTP(w, r)
+}
+
+// serveEvents streams balancer events as Server-Sent Events. Clients get the
+// recent health and retry history first, then live events plus a periodic
+// status snapshot carrying in-flight counts.
+func (h *AdminHandler) serveEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	rc := http.NewResponseController(w)
+	_ = rc.SetWriteDeadline(time.Time{})
+
+	hub := h.balancer.events
+	ch := hub.Subscribe()
+	defer hub.Unsubscribe(ch)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	if err := writeSSE(w, "status", h.balancer.Status()); err != nil {
+		return
+	}
+	for _, ev := range hub.Recent() {
+		if err := writeSSE(w, ev.Type, ev); err != nil {
+			return
+		}
+	}
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	ticker := time.NewTicker(uiStatusInterval)
+	defer ticker.Stop()
+	for {
+		var err error
+		select {
+		case <-r.Context().Done():
+			return
+		case ev := <-ch:
+			err = writeSSE(w, ev.Type, ev)
+		case <-ticker.C:
+			err = writeSSE(w, "status", h.balancer.Status())
+		}
+		if err == nil {
+			err = rc.Flush()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func writeSSE(w http.ResponseWriter, event string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload)
+	return err
+}
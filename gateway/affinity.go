@@ -0,0 +1,147 @@
+package gateway
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// affinityRing is a consistent-hash ring over every node, with points in
+// proportion to the configured weight so it stays put while effective
+// weights move. It is rebuilt when the node list changes.
+type affinityRing struct {
+	points []ringPoint
+	nodes  []*Node
+}
+
+func (b *Balancer) rebuildAffinityRing() {
+	var nodes []*Node
+	var maxW int32
+	b.ForEachNode(func(n *Node) {
+		nodes = append(nodes, n)
+		if n.InitialWeight > maxW {
+			maxW = n.InitialWeight
+		}
+	})
+	ring := &affinityRing{nodes: nodes}
+	for _, n := range nodes {
+		count := 1
+		if maxW > 0 {
+			count = int(int64(ringPointsMax) * int64(n.InitialWeight) / int64(maxW))
+			if count < 1 {
+				count = 1
+			}
+		}
+		for i := 0; i < count; i++ {
+			ring.points = append(ring.points, ringPoint{hash: hashKey(n.ID + "#" + strconv.Itoa(i)), node: n})
+		}
+	}
+	sort.Slice(ring.points, func(i, j int) bool { return ring.points[i].hash < ring.points[j].hash })
+	b.affinity.Store(ring)
+}
+
+// requestKey returns the key used to pick a node for r: the configured
+// affinity key when present, otherwise the client IP without its port.
+// The second result reports whether it came from the affinity setting.
+func (b *Balancer) requestKey(r *http.Request) (string, bool) {
+	spec := b.config.Strategy.AffinityKey
+	if spec != "" {
+		kind, name, _ := strings.Cut(spec, ":")
+		var key string
+		switch kind {
+		case "header":
+			key = r.Header.Get(name)
+		case "cookie":
+			if c, err := r.Cookie(name); err == nil {
+				key = c.Value
+			}
+		case "client_ip":
+			key = clientIP(r)
+		}
+		if key != "" {
+			return key, true
+		}
+	}
+	return clientIP(r), false
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// selectAffinity walks the ring clockwise from key and returns the first
+// usable node whose in-flight count stays within affinity_load_factor of
+// the average (consistent hashing with bounded loads). It returns nil when
+// no node qualifies, and the caller falls back to Select.
+func (b *Balancer) selectAffinity(key string) *Node {
+	ring := b.affinity.Load()
+	if ring == nil || len(ring.points) == 0 {
+		return nil
+	}
+	cfg := b.config.Strategy
+	usable := 0
+	for _, n := range ring.nodes {
+		if affinityUsable(n, cfg.MinWeight) {
+			usable++
+		}
+	}
+	if usable == 0 {
+		return nil
+	}
+	limit := int32(math.Ceil(cfg.AffinityLoadFactor * float64(atomic.LoadInt64(&b.totalInflight)+1) / float64(usable)))
+
+	h := hashKey(key)
+	start := sort.Search(len(ring.points), func(i int) bool { return ring.points[i].hash >= h })
+	tried := make(map[*Node]bool, len(ring.nodes))
+	for i := 0; i < len(ring.points) && len(tried) < len(ring.nodes); i++ {
+		n := ring.points[(start+i)%len(ring.points)].node
+		if tried[n] {
+			continue
+		}
+		tried[n] = true
+		if !affinityUsable(n, cfg.MinWeight) {
+			continue
+		}
+		if atomic.LoadInt32(&n.inflight)+1 > limit {
+			continue
+		}
+		if len(tried) > 1 {
+			Debug("affinity moved", "node", n.ID, "skipped", len(tried)-1)
+		}
+		return n
+	}
+	return nil
+}
+
+// affinityUsable reports whether n is enabled and not ejected to
+// min_weight.
+func affinityUsable(n *Node, minWeight int32) bool {
+	if n.State() != NodeEnabled {
+		return false
+	}
+	ew := atomic.LoadInt32(&n.effectiveWeight)
+	if ew <= 0 {
+		return false
+	}
+	return ew > minWeight || ew >= n.InitialWeight
+}
+
+func validateAffinityKey(spec string) error {
+	if spec == "" || spec == "client_ip" {
+		return nil
+	}
+	kind, name, ok := strings.Cut(spec, ":")
+	if !ok || name == "" || (kind != "header" && kind != "cookie") {
+		return fmt.Errorf("want client_ip, header:<name> or cookie:<name>, got %q", spec)
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package gateway
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func affinityBalancer(t *testing.T) *Balancer {
+	t.Helper()
+	b := testBalancer(t,
+		NodeConfig{ID: "a", Address: "http://127.0.0.1:9001", Weight: 100},
+		NodeConfig{ID: "b", Address: "http://127.0.0.1:9002", Weight: 100},
+		NodeConfig{ID: "c", Address: "http://127.0.0.1:9003", Weight: 100},
+	)
+	b.config.Strategy.AffinityLoadFactor = 1.25
+	return b
+}
+
+func TestSelectAffinityStable(t *testing.T) {
+	b := affinityBalancer(t)
+	for i := 0; i < 50; i++ {
+		key := fmt.Sprintf("user-%d", i)
+		home := b.selectAffinity(key)
+		if home == nil {
+			t.Fatalf("%s: no node selected", key)
+		}
+		if got := b.selectAffinity(key); got != home {
+			t.Errorf("%s: selected %s, then %s", key, home.ID, got.ID)
+		}
+	}
+}
+
+func TestSelectAffinityLoadCap(t *testing.T) {
+	b := affinityBalancer(t)
+	const key = "user-42"
+	home := b.selectAffinity(key)
+	if home == nil {
+		t.Fatal("no home node")
+	}
+
+	// Four requests on the home node and none elsewhere: the limit is
+	// ceil(1.25 * 5 / 3) = 3, so a fifth would overload it.
+	for i := 0; i < 4; i++ {
+		b.adjustConn(home, 1)
+	}
+	moved := b.selectAffinity(key)
+	if moved == nil || moved == home {
+		t.Fatalf("overloaded home %s still selected", home.ID)
+	}
+	if got := b.selectAffinity(key); got != moved {
+		t.Errorf("spill node changed from %s to %s", moved.ID, got.ID)
+	}
+
+	for i := 0; i < 4; i++ {
+		b.adjustConn(home, -1)
+	}
+	if got := b.selectAffinity(key); got != home {
+		t.Errorf("selected %s after load dropped, want home %s", got.ID, home.ID)
+	}
+}
+
+func TestSelectAffinitySkipsUnusable(t *testing.T) {
+	b := affinityBalancer(t)
+	const key = "user-7"
+	home := b.selectAffinity(key)
+	home.Drain()
+	if got := b.selectAffinity(key); got == nil || got == home {
+		t.Fatalf("selected %v, want a node other than the drained %s", got, home.ID)
+	}
+	b.ForEachNode(func(n *Node) { n.Drain() })
+	if got := b.selectAffinity(key); got != nil {
+		t.Errorf("selected %s with every node drained, want nil", got.ID)
+	}
+}
+
+func TestValidateAffinityKey(t *testing.T) {
+	tests := []struct {
+		spec string
+		ok   bool
+	}{
+		{"", true},
+		{"client_ip", true},
+		{"header:X-User-ID", true},
+		{"cookie:session", true},
+		{"header:", false},
+		{"header", false},
+		{"query:user", false},
+		{"client_ip:x", false},
+	}
+	for _, tt := range tests {
+		if err := validateAffinityKey(tt.spec); (err == nil) != tt.ok {
+			t.Errorf("%q: err = %v, want ok %v", tt.spec, err, tt.ok)
+		}
+	}
+}
+
+func TestRequestKey(t *testing.T) {
+	tests := []struct {
+		name     string
+		spec     string
+		header   string
+		cookie   string
+		want     string
+		affinity bool
+	}{
+		{"no affinity key", "", "u1", "", "192.0.2.1", false},
+		{"client ip", "client_ip", "", "", "192.0.2.1", true},
+		{"header", "header:X-User-ID", "u1", "", "u1", true},
+		{"missing header", "header:X-User-ID", "", "", "192.0.2.1", false},
+		{"cookie", "cookie:session", "", "s1", "s1", true},
+		{"missing cookie", "cookie:session", "u1", "", "192.0.2.1", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := affinityBalancer(t)
+			b.config.Strategy.AffinityKey = tt.spec
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = "192.0.2.1:51234"
+			if tt.header != "" {
+				r.Header.Set("X-User-ID", tt.header)
+			}
+			if tt.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: "session", Value: tt.cookie})
+			}
+			key, affinity := b.requestKey(r)
+			if key != tt.want || affinity != tt.affinity {
+				t.Errorf("requestKey = %q, %v, want %q, %v", key, affinity, tt.want, tt.affinity)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+type AuditRecord struct {
+	Time       time.Time      `json:"time"`
+	Token      string         `json:"token"`
+	RemoteAddr string         `json:"remote_addr"`
+	ClientCert string         `json:"client_cert,omitempty"`
+	Action     string         `json:"action"`
+	Target     string         `json:"target,omitempty"`
+	Result     string         `json:"result"`
+	Error      string         `json:"error,omitempty"`
+	Changes    []ConfigChange `json:"changes,omitempty"`
+}
+
+var auditMu sync.Mutex
+
+// audit appends one JSON line to admin_audit_log. The file is opened per
+// record so it can be rotated externally and the path changed on reload.
+func (h *AdminHandler) audit(r *http.Request, action, target string, changes []ConfigChange, err error) {
+	path := h.balancer.Config().Gateway.AdminAuditLog
+	if path == "" {
+		return
+	}
+	rec := AuditRecord{
+		Time:       time.Now(),
+		Token:      adminTokenName(r),
+		RemoteAddr: r.RemoteAddr,
+		Action:     action,
+		Target:     target,
+		Result:     "ok",
+		Changes:    changes,
+	}
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		rec.ClientCert = r.TLS.PeerCertificates[0].Subject.CommonName
+	}
+	if err != nil {
+		rec.Result = "error"
+		rec.Error = err.Error()
+	}
+	line, mErr := json.Marshal(rec)
+	if mErr != nil {
+		Error("audit encode failed", "action", action, "err", mErr)
+		return
+	}
+	line = append(line, '\n')
+
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	f, oErr := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if oErr != nil {
+		Error("audit open failed", "path", path, "err", oErr)
+		return
+	}
+	defer f.Close()
+	if _, wErr := f.Write(line); wErr != nil {
+		Error("audit write failed", "path", path, "err", wErr)
+	}
+}
@@ -1,6 +1,8 @@
 package gateway
 
 import (
+	"errors"
+	"fmt"
 	"hash/fnv"
 	"math"
 	"math/rand"
@@ -11,6 +13,27 @@ import (
 	"time"
 )
 
+type NodeState int32
+
+const (
+	NodeEnabled NodeState = iota
+	NodeDraining
+	NodeDisabled
+)
+
+func (s NodeState) String() string {
+	switch s {
+	case NodeEnabled:
+		return "enabled"
+	case NodeDraining:
+		return "draining"
+	case NodeDisabled:
+		return "disabled"
+	default:
+		return "unknown"
+	}
+}
+
 type Node struct {
 	ID              string
 	Address         string
@@ -25,11 +48,23 @@ type Node struct {
 	penaltyWindow   uint64
 	inflight        int32
 	connDeltaBits   uint64
+	latencyBits     uint64
+	ttfbBits        uint64
+	latencySamples  uint32
+	latencyScore    int32
+	state           int32
+	events          *eventHub
+	lastHealth      atomic.Pointer[HealthRecord]
+	history         *healthHistory
+	override        atomic.Pointer[ScoreOverride]
+	replacedBy      atomic.Pointer[Node]
 }
 
 type Bucket struct {
-	mu    sync.Mutex
-	nodes []*Node
+	mu         sync.Mutex
+	nodes      []*Node
+	strategy   Strategy
+	candidates []*Node
 }
 
 type Balancer struct {
@@ -41,6 +76,11 @@ type Balancer struct {
 	cfgMu         sync.RWMutex
 	totalInflight int64
 	nodeCount     int32
+	events        *eventHub
+	metrics       *metrics
+	access        *accessLog
+	affinity      atomic.Pointer[affinityRing]
+	notifier      *Notifier
 }
 
 func NewBalancer(cfg *Config) (*Balancer, error) {
@@ -48,10 +88,19 @@ func NewBalancer(cfg *Config) (*Balancer, error) {
 		buckets: make([]*Bucket, cfg.Gateway.Shards),
 		config:  cfg,
 		rand:    rand.New(rand.NewSource(time.Now().UnixNano())),
+		events:  newEventHub(),
+		metrics: newMetrics(),
 	}
 	setTransportConfig(cfg)
+	if err := checkRingHash(cfg.Strategy, cfg.Gateway.Shards); err != nil {
+		return nil, err
+	}
 	for i := 0; i < cfg.Gateway.Shards; i++ {
-		b.buckets[i] = &Bucket{}
+		strategy, err := newStrategy(cfg.Strategy.Algorithm)
+		if err != nil {
+			return nil, err
+		}
+		b.buckets[i] = &Bucket{strategy: strategy}
 	}
 
 	for _, nc := range cfg.Nodes {
@@ -59,11 +108,19 @@ func NewBalancer(cfg *Config) (*Balancer, error) {
 		if err != nil {
 			return nil, err
 		}
+		node.events = b.events
+		node.history = newHealthHistory(cfg.Gateway.HealthCheckDefault.HistorySize)
 		idx := b.pickBucketIndex(nc.Address)
 		b.buckets[idx].nodes = append(b.buckets[idx].nodes, node)
-		b.nodeMap.Store(nc.Address, node)
+		b.nodeMap.Store(nc.ID, node)
 	}
 	b.nodeCount = int32(len(cfg.Nodes))
+	b.rebuildAffinityRing()
+	access, err := newAccessLog(cfg.AccessLog)
+	if err != nil {
+		return nil, err
+	}
+	b.access = access
 	return b, nil
 }
 
@@ -84,35 +141,37 @@ func (b *Balancer) pickBucketIndex(key string) int {
 func (b *Balancer) Select(key string) *Node {
 	b.cfgMu.RLock()
 	idx := b.pickBucketIndex(key)
-	bucket := b.buckets[idx]
-	if len(bucket.nodes) == 0 {
-		// fallback: find the first non-empty bucket
-		for _, bk := range b.buckets {
-			if len(bk.nodes) > 0 {
-				bucket = bk
-				break
-			}
+	b.cfgMu.RUnlock()
+
+	if n := b.buckets[idx].selectNode(key); n != nil {
+		return n
+	}
+	// fallback: the picked bucket is empty or has no routable node
+	for i, bk := range b.buckets {
+		if i == idx {
+			continue
+		}
+		if n := bk.selectNode(key); n != nil {
+			return n
 		}
 	}
-	b.cfgMu.RUnlock()
+	return nil
+}
 
-	bucket.mu.Lock()
-	defer bucket.mu.Unlock()
+func (bk *Bucket) selectNode(key string) *Node {
+	bk.mu.Lock()
+	defer bk.mu.Unlock()
 
-	var total int32
-	var best *Node
-	for _, n := range bucket.nodes {
-		ew := atomic.LoadInt32(&n.effectiveWeight)
-		n.currentWeight += ew
-		total += ew
-		if best == nil || n.currentWeight > best.currentWeight {
-			best = n
+	bk.candidates = bk.candidates[:0]
+	for _, n := range bk.nodes {
+		if n.State() == NodeEnabled {
+			bk.candidates = append(bk.candidates, n)
 		}
 	}
-	if best != nil {
-		best.currentWeight -= total
+	if len(bk.candidates) == 0 {
+		return nil
 	}
-	return best
+	return bk.strategy.Pick(bk.candidates, key)
 }
 
 func (b *Balancer) ForEachNode(fn func(n *Node)) {
@@ -143,7 +202,18 @@ func (n *Node) UpdateEffectiveWeight(delta int32, min int32) {
 }
 
 func (n *Node) SyncWeight(passiveScore float64, activeScore float64, connDelta float64) {
-	targetScore := math.Min(passiveScore, activeScore)
+	if o := n.Override(); o != nil && o.EffectiveWeight != nil {
+		w := *o.EffectiveWeight
+		if w < 0 {
+			w = 0
+		}
+		if w > n.InitialWeight {
+			w = n.InitialWeight
+		}
+		n.storeWeight(w)
+		return
+	}
+	targetScore := math.Min(math.Min(passiveScore, activeScore), n.LatencyScore())
 	if connDelta != 0 {
 		targetScore += connDelta
 		if targetScore < 0 {
@@ -156,7 +226,7 @@ func (n *Node) SyncWeight(passiveScore float64, activeScore float64, connDelta f
 	current := atomic.LoadInt32(&n.effectiveWeight)
 	target := int32(float64(n.InitialWeight) * (targetScore / 100.0))
 	if target < current {
-		atomic.StoreInt32(&n.effectiveWeight, target)
+		n.storeWeight(target)
 		return
 	}
 	if target > current {
@@ -165,7 +235,13 @@ func (n *Node) SyncWeight(passiveScore float64, activeScore float64, connDelta f
 		if next > target {
 			next = target
 		}
-		atomic.StoreInt32(&n.effectiveWeight, next)
+		n.storeWeight(next)
+	}
+}
+
+func (n *Node) storeWeight(w int32) {
+	if atomic.SwapInt32(&n.effectiveWeight, w) != w {
+		n.events.publishNode(n)
 	}
 }
 
@@ -220,7 +296,53 @@ func (n *Node) limitPenalty(delta int32, maxPenaltyPerSecond int32) int32 {
 	}
 }
 
+func (n *Node) State() NodeState {
+	return NodeState(atomic.LoadInt32(&n.state))
+}
+
+func (n *Node) SetState(state NodeState) {
+	if atomic.SwapInt32(&n.state, int32(state)) != int32(state) {
+		n.events.publishNode(n)
+	}
+}
+
+// current follows config reloads from n to the node that now serves its id,
+// so requests started before a reload finish on the live node.
+func (n *Node) current() *Node {
+	for next := n.replacedBy.Load(); next != nil; next = n.replacedBy.Load() {
+		n = next
+	}
+	return n
+}
+
+// replaceWith hands n's in-flight requests to next, which replaces it after
+// a config change.
+func (n *Node) replaceWith(next *Node) {
+	n.replacedBy.Store(next)
+	n.addInflight(0)
+}
+
+// addInflight adjusts the in-flight count and moves anything left on a
+// replaced node to its replacement, so each request is counted once.
+func (n *Node) addInflight(delta int32) {
+	atomic.AddInt32(&n.inflight, delta)
+	for next := n.replacedBy.Load(); next != nil; next = n.replacedBy.Load() {
+		atomic.AddInt32(&next.inflight, atomic.SwapInt32(&n.inflight, 0))
+		n = next
+	}
+}
+
+// Drain takes the node out of rotation and moves it to disabled once its
+// in-flight requests have finished.
+func (n *Node) Drain() {
+	n.SetState(NodeDraining)
+	go drainNode(n)
+}
+
 func (n *Node) PassiveScore() float64 {
+	if o := n.Override(); o != nil && o.PassiveScore != nil {
+		return float64(*o.PassiveScore)
+	}
 	return float64(atomic.LoadInt32(&n.passiveScore))
 }
 
@@ -245,6 +367,9 @@ func (n *Node) SetActiveScore(score int32) {
 }
 
 func (n *Node) ActiveScore() float64 {
+	if o := n.Override(); o != nil && o.ActiveScore != nil {
+		return float64(*o.ActiveScore)
+	}
 	return float64(atomic.LoadInt32(&n.activeScore))
 }
 
@@ -256,28 +381,221 @@ func (n *Node) SetConnDelta(delta float64) {
 	atomic.StoreUint64(&n.connDeltaBits, math.Float64bits(delta))
 }
 
+func (b *Balancer) Node(id string) *Node {
+	v, ok := b.nodeMap.Load(id)
+	if !ok {
+		return nil
+	}
+	return v.(*Node)
+}
+
+func (b *Balancer) Config() Config {
+	b.cfgMu.RLock()
+	defer b.cfgMu.RUnlock()
+	cfg := *b.config
+	cfg.Nodes = append([]NodeConfig(nil), b.config.Nodes...)
+	return cfg
+}
+
+func (b *Balancer) ApplyNodes(nodes []NodeConfig) error {
+	b.cfgMu.Lock()
+	defer b.cfgMu.Unlock()
+
+	if err := b.applyNodesLocked(nodes); err != nil {
+		return err
+	}
+	b.rebuildAffinityRing()
+	b.updateConnFactorLocked()
+	b.updateLatencyScoresLocked()
+	return nil
+}
+
 func (b *Balancer) ApplyConfig(next *Config) error {
 	b.cfgMu.Lock()
 	defer b.cfgMu.Unlock()
 
-	if len(next.Nodes) != len(b.config.Nodes) {
-		Warnf("admin reload: node list change ignored (current=%d next=%d)", len(b.config.Nodes), len(next.Nodes))
+	// Build the strategies before touching the nodes so an invalid
+	// algorithm leaves the running config as it was. Shards only change on
+	// restart, so ring_hash is checked against the running count.
+	if err := checkRingHash(next.Strategy, len(b.buckets)); err != nil {
+		return err
+	}
+	var strategies []Strategy
+	if next.Strategy.Algorithm != b.config.Strategy.Algorithm {
+		for range b.buckets {
+			strategy, err := newStrategy(next.Strategy.Algorithm)
+			if err != nil {
+				return err
+			}
+			strategies = append(strategies, strategy)
+		}
+	}
+
+	if err := b.applyNodesLocked(next.Nodes); err != nil {
+		return err
 	}
 
+	for i, strategy := range strategies {
+		bucket := b.buckets[i]
+		bucket.mu.Lock()
+		bucket.strategy = strategy
+		bucket.mu.Unlock()
+	}
 	b.config.Gateway = next.Gateway
 	b.config.Strategy = next.Strategy
-	// Node list reload not supported yet; keep current nodes.
+	b.config.Capture = next.Capture
+	b.config.Notify = next.Notify
+	if b.notifier != nil {
+		b.notifier.setEnabled(len(next.Notify.Webhooks) > 0)
+	}
+	b.ForEachNode(func(n *Node) {
+		n.history.resize(next.Gateway.HealthCheckDefault.HistorySize)
+	})
+
+	b.rebuildAffinityRing()
 
 	setTransportConfig(b.config)
 	b.updateConnFactorLocked()
+	b.updateLatencyScoresLocked()
 	return nil
 }
 
+// applyNodesLocked diffs the running node list against next by node id.
+// Unchanged nodes keep their runtime state, changed nodes are rebuilt in
+// place with their scores, latency and in-flight count carried over, added
+// nodes are placed into buckets and removed nodes are taken out of rotation
+// and drained.
+func (b *Balancer) applyNodesLocked(next []NodeConfig) error {
+	current := make(map[string]NodeConfig, len(b.config.Nodes))
+	for _, nc := range b.config.Nodes {
+		current[nc.ID] = nc
+	}
+
+	seen := make(map[string]bool, len(next))
+	added := make([]*Node, 0)
+	changed := make(map[string]*Node)
+	for _, nc := range next {
+		if nc.ID == "" {
+			return errors.New("node id required")
+		}
+		if seen[nc.ID] {
+			return fmt.Errorf("duplicate node id %q", nc.ID)
+		}
+		seen[nc.ID] = true
+		prev, ok := current[nc.ID]
+		if ok && prev == nc {
+			continue
+		}
+		node, err := NewNode(nc)
+		if err != nil {
+			return fmt.Errorf("node %s: %w", nc.ID, err)
+		}
+		node.events = b.events
+		if !ok {
+			node.history = newHealthHistory(b.config.Gateway.HealthCheckDefault.HistorySize)
+			added = append(added, node)
+			continue
+		}
+		if old := b.Node(nc.ID); old != nil {
+			node.SetPassiveScore(atomic.LoadInt32(&old.passiveScore))
+			node.SetActiveScore(atomic.LoadInt32(&old.activeScore))
+			node.SetConnDelta(old.ConnDelta())
+			atomic.StoreUint64(&node.latencyBits, atomic.LoadUint64(&old.latencyBits))
+			atomic.StoreUint64(&node.ttfbBits, atomic.LoadUint64(&old.ttfbBits))
+			atomic.StoreUint32(&node.latencySamples, atomic.LoadUint32(&old.latencySamples))
+			atomic.StoreInt32(&node.latencyScore, atomic.LoadInt32(&old.latencyScore))
+			node.lastHealth.Store(old.lastHealth.Load())
+			node.history = old.history
+			node.SetState(old.State())
+			node.SyncWeight(node.PassiveScore(), node.ActiveScore(), node.ConnDelta())
+			if o := old.Override(); o != nil {
+				node.SetOverride(o)
+			}
+		}
+		changed[nc.ID] = node
+	}
+
+	var removed []*Node
+	for _, bucket := range b.buckets {
+		bucket.mu.Lock()
+		kept := make([]*Node, 0, len(bucket.nodes))
+		for _, n := range bucket.nodes {
+			if !seen[n.ID] {
+				removed = append(removed, n)
+				continue
+			}
+			if repl, ok := changed[n.ID]; ok {
+				removed = append(removed, n)
+				kept = append(kept, repl)
+				continue
+			}
+			kept = append(kept, n)
+		}
+		bucket.nodes = kept
+		bucket.mu.Unlock()
+	}
+
+	for _, n := range added {
+		idx := b.pickBucketIndex(n.Address)
+		bucket := b.buckets[idx]
+		bucket.mu.Lock()
+		bucket.nodes = append(bucket.nodes, n)
+		bucket.mu.Unlock()
+	}
+
+	for _, n := range removed {
+		if !seen[n.ID] {
+			b.nodeMap.Delete(n.ID)
+			Info("node removed", "node", n.ID, "address", n.Address, "inflight", atomic.LoadInt32(&n.inflight))
+		} else {
+			Info("node changed", "node", n.ID, "address", n.Address)
+			n.replaceWith(changed[n.ID])
+		}
+		n.Drain()
+	}
+	for _, n := range changed {
+		b.nodeMap.Store(n.ID, n)
+		// A node that was draining keeps draining under its new config.
+		if n.State() == NodeDraining {
+			n.Drain()
+		}
+	}
+	for _, n := range added {
+		b.nodeMap.Store(n.ID, n)
+		Info("node added", "node", n.ID, "address", n.Address, "weight", n.InitialWeight)
+	}
+
+	b.config.Nodes = append([]NodeConfig(nil), next...)
+	atomic.StoreInt32(&b.nodeCount, int32(len(next)))
+	return nil
+}
+
+// drainNode waits for the requests still running on a node that has been
+// taken out of rotation. A node that is still draining when they finish is
+// marked disabled; enabling it in the meantime cancels the drain.
+func drainNode(n *Node) {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		if n.State() != NodeDraining {
+			return
+		}
+		if atomic.LoadInt32(&n.inflight) <= 0 {
+			if atomic.CompareAndSwapInt32(&n.state, int32(NodeDraining), int32(NodeDisabled)) {
+				n.events.publishNode(n)
+				Info("node drained", "node", n.ID, "address", n.Address)
+			}
+			return
+		}
+		<-ticker.C
+	}
+}
+
 func (b *Balancer) adjustConn(node *Node, delta int32) {
 	if node == nil || delta == 0 {
 		return
 	}
-	atomic.AddInt32(&node.inflight, delta)
+	node.addInflight(delta)
 	atomic.AddInt64(&b.totalInflight, int64(delta))
 	b.updateConnFactor()
 }
@@ -0,0 +1,179 @@
+package gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func testBalancer(t *testing.T, nodes ...NodeConfig) *Balancer {
+	t.Helper()
+	cfg := &Config{Nodes: nodes}
+	cfg.Gateway.Shards = 2
+	cfg.Strategy.LatencyEWMAAlpha = 0.5
+	b, err := NewBalancer(cfg)
+	if err != nil {
+		t.Fatalf("NewBalancer: %v", err)
+	}
+	return b
+}
+
+func bucketNodes(b *Balancer) map[string]*Node {
+	out := make(map[string]*Node)
+	b.ForEachNode(func(n *Node) { out[n.ID] = n })
+	return out
+}
+
+func TestApplyNodesDiff(t *testing.T) {
+	b := testBalancer(t,
+		NodeConfig{ID: "keep", Address: "http://127.0.0.1:9001", Weight: 100},
+		NodeConfig{ID: "change", Address: "http://127.0.0.1:9002", Weight: 100},
+		NodeConfig{ID: "drop", Address: "http://127.0.0.1:9003", Weight: 100},
+	)
+	keep := b.Node("keep")
+	changed := b.Node("change")
+	dropped := b.Node("drop")
+
+	changed.SetPassiveScore(60)
+	changed.observeLatency(80*time.Millisecond, 20*time.Millisecond, 0.5)
+	b.adjustConn(changed, 1)
+	b.adjustConn(changed, 1)
+
+	err := b.ApplyNodes([]NodeConfig{
+		{ID: "keep", Address: "http://127.0.0.1:9001", Weight: 100},
+		{ID: "change", Address: "http://127.0.0.1:9002", Weight: 50},
+		{ID: "add", Address: "http://127.0.0.1:9004", Weight: 100},
+	})
+	if err != nil {
+		t.Fatalf("ApplyNodes: %v", err)
+	}
+
+	live := bucketNodes(b)
+	if len(live) != 3 {
+		t.Fatalf("bucket nodes = %d, want 3", len(live))
+	}
+	if b.Node("keep") != keep || live["keep"] != keep {
+		t.Error("unchanged node was rebuilt")
+	}
+	if b.Node("drop") != nil || live["drop"] != nil {
+		t.Error("removed node still routable")
+	}
+	if dropped.State() == NodeEnabled {
+		t.Errorf("removed node state = %s, want draining or disabled", dropped.State())
+	}
+	if b.Node("add") == nil || live["add"] == nil {
+		t.Error("added node missing")
+	}
+
+	repl := b.Node("change")
+	if repl == changed || live["change"] != repl {
+		t.Fatal("changed node was not replaced in place")
+	}
+	if repl.InitialWeight != 50 {
+		t.Errorf("replacement weight = %d, want 50", repl.InitialWeight)
+	}
+	if repl.PassiveScore() != 60 {
+		t.Errorf("passive score = %v, want 60", repl.PassiveScore())
+	}
+	if repl.LatencyEWMA() != changed.LatencyEWMA() || atomic.LoadUint32(&repl.latencySamples) != 1 {
+		t.Errorf("latency not carried: ewma %v samples %d", repl.LatencyEWMA(), atomic.LoadUint32(&repl.latencySamples))
+	}
+	if got := atomic.LoadInt32(&repl.inflight); got != 2 {
+		t.Errorf("replacement inflight = %d, want 2", got)
+	}
+
+	// Requests started on the old node complete against the replacement.
+	b.adjustConn(changed, -1)
+	changed.current().observeLatency(40*time.Millisecond, 10*time.Millisecond, 0.5)
+	if got := atomic.LoadInt32(&repl.inflight); got != 1 {
+		t.Errorf("replacement inflight after completion = %d, want 1", got)
+	}
+	if got := atomic.LoadInt32(&changed.inflight); got != 0 {
+		t.Errorf("old node inflight = %d, want 0", got)
+	}
+	if got := atomic.LoadUint32(&repl.latencySamples); got != 2 {
+		t.Errorf("replacement samples = %d, want 2", got)
+	}
+	if got := atomic.LoadInt64(&b.totalInflight); got != 1 {
+		t.Errorf("total inflight = %d, want 1", got)
+	}
+}
+
+func TestApplyNodesKeepsDraining(t *testing.T) {
+	b := testBalancer(t, NodeConfig{ID: "a", Address: "http://127.0.0.1:9001", Weight: 100})
+	old := b.Node("a")
+	b.adjustConn(old, 1)
+	old.Drain()
+
+	if err := b.ApplyNodes([]NodeConfig{{ID: "a", Address: "http://127.0.0.1:9001", Weight: 80}}); err != nil {
+		t.Fatalf("ApplyNodes: %v", err)
+	}
+	repl := b.Node("a")
+	if repl.State() != NodeDraining {
+		t.Fatalf("replacement state = %s, want draining", repl.State())
+	}
+
+	b.adjustConn(old, -1)
+	deadline := time.Now().Add(2 * time.Second)
+	for repl.State() != NodeDisabled {
+		if time.Now().After(deadline) {
+			t.Fatalf("replacement state = %s, want disabled after drain", repl.State())
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestReloadDuringRequestScoresReplacement(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{})
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		close(started)
+		<-release
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer up.Close()
+
+	b := testBalancer(t, NodeConfig{ID: "a", Address: up.URL, Weight: 100})
+	old := b.Node("a")
+	old.SetPassiveScore(50)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		b.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/x", nil))
+	}()
+	<-started
+	if err := b.ApplyNodes([]NodeConfig{{ID: "a", Address: up.URL, Weight: 80}}); err != nil {
+		t.Fatalf("ApplyNodes: %v", err)
+	}
+	close(release)
+	<-done
+
+	repl := b.Node("a")
+	if repl == old {
+		t.Fatal("node was not replaced")
+	}
+	if got := repl.PassiveScore(); got != 45 {
+		t.Errorf("replacement passive score = %v, want 45", got)
+	}
+	if got := atomic.LoadInt32(&repl.inflight); got != 0 {
+		t.Errorf("replacement inflight = %d, want 0", got)
+	}
+}
+
+func TestApplyConfigRejectsStrategyBeforeNodes(t *testing.T) {
+	b := testBalancer(t, NodeConfig{ID: "a", Address: "http://127.0.0.1:9001", Weight: 100})
+	for _, algorithm := range []string{"bogus", "ring_hash"} {
+		next := b.Config()
+		next.Strategy.Algorithm = algorithm
+		next.Nodes = []NodeConfig{{ID: "b", Address: "http://127.0.0.1:9002", Weight: 100}}
+		if err := b.ApplyConfig(&next); err == nil {
+			t.Fatalf("%s: ApplyConfig succeeded, want error", algorithm)
+		}
+		if b.Node("a") == nil || b.Node("b") != nil {
+			t.Errorf("%s: node set changed by a rejected config", algorithm)
+		}
+	}
+}
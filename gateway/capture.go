@@ -0,0 +1,389 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+)
+
+var defaultCaptureRedact = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Krypton-Token"}
+
+// captureSession holds the attempts captured for one client request. A nil
+// session (capture off or request not selected) ignores every call.
+type captureSession struct {
+	cfg       CaptureConfig
+	requestID string
+	file      string
+	body      []byte
+	mu        sync.Mutex
+	entries   []*harEntry
+}
+
+type captureAttempt struct {
+	session *captureSession
+	entry   *harEntry
+	start   time.Time
+	body    *cappedBuffer
+}
+
+func (b *Balancer) startCapture(r *http.Request, reqID string) *captureSession {
+	cfg := b.config.Capture
+	if !cfg.Enabled {
+		return nil
+	}
+	if len(cfg.Paths) > 0 {
+		matched := false
+		for _, p := range cfg.Paths {
+			if strings.HasPrefix(r.URL.Path, p) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return nil
+		}
+	}
+	if cfg.SampleRate < 1 {
+		b.randMu.Lock()
+		skip := b.rand.Float64() >= cfg.SampleRate
+		b.randMu.Unlock()
+		if skip {
+			return nil
+		}
+	}
+	// The file name is generated here; the request id may come from the
+	// client and is only kept inside the record.
+	file := fmt.Sprintf("capture-%d-%d", time.Now().UnixNano(), atomic.AddUint64(&captureSeq, 1))
+	s := &captureSession{cfg: cfg, requestID: reqID, file: file}
+	if r.GetBody != nil {
+		if rc, err := r.GetBody(); err == nil {
+			s.body, _ = io.ReadAll(io.LimitReader(rc, int64(cfg.MaxBodyBytes)+1))
+			_ = rc.Close()
+		}
+	}
+	return s
+}
+
+// attempt starts recording one upstream attempt, or returns nil when the
+// node is filtered out.
+func (s *captureSession) attempt(r *http.Request, node *Node, attempt int) *captureAttempt {
+	if s == nil {
+		return nil
+	}
+	if len(s.cfg.Nodes) > 0 {
+		matched := false
+		for _, id := range s.cfg.Nodes {
+			if id == node.ID {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return nil
+		}
+	}
+	now := time.Now()
+	e := &harEntry{
+		StartedDateTime: now.Format(time.RFC3339Nano),
+		Request:         s.harRequest(r),
+		Response:        harResponse{Headers: []harHeader{}, Cookies: []struct{}{}, HeadersSize: -1, BodySize: -1},
+		Node:            node.ID,
+		Attempt:         attempt,
+		RequestID:       s.requestID,
+		Truncated:       len(s.body) > s.cfg.MaxBodyBytes,
+	}
+	s.mu.Lock()
+	s.entries = append(s.entries, e)
+	s.mu.Unlock()
+	return &captureAttempt{session: s, entry: e, start: now}
+}
+
+// response records the upstream response and tees its body, up to the
+// configured cap, as it is streamed to the client.
+func (a *captureAttempt) response(resp *http.Response) {
+	if a == nil {
+		return
+	}
+	if resp.Request != nil {
+		a.entry.Request = a.session.harRequest(resp.Request)
+	}
+	a.entry.Response.Status = resp.StatusCode
+	a.entry.Response.StatusText = http.StatusText(resp.StatusCode)
+	a.entry.Response.HTTPVersion = resp.Proto
+	a.entry.Response.Headers = a.session.harHeaders(resp.Header)
+	a.entry.Response.Content.MimeType = resp.Header.Get("Content-Type")
+	a.body = &cappedBuffer{limit: a.session.cfg.MaxBodyBytes}
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.TeeReader(resp.Body, a.body), resp.Body}
+}
+
+// drain records a response that is dropped before reaching the client,
+// reading its body up to the cap so the record keeps it.
+func (a *captureAttempt) drain(resp *http.Response) {
+	if a == nil {
+		return
+	}
+	a.response(resp)
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, int64(a.session.cfg.MaxBodyBytes)+1))
+}
+
+func (a *captureAttempt) fail(err error) {
+	if a == nil || err == nil {
+		return
+	}
+	a.entry.Error = err.Error()
+}
+
+func (a *captureAttempt) finish() {
+	if a == nil {
+		return
+	}
+	elapsed := float64(time.Since(a.start).Microseconds()) / 1000
+	a.entry.Time = elapsed
+	a.entry.Timings = harTimings{Send: 0, Wait: elapsed, Receive: 0}
+	if a.body != nil {
+		a.entry.Response.BodySize = a.body.total
+		a.entry.Response.Content.Size = a.body.total
+		a.entry.Response.Content.Text, a.entry.Response.Content.Encoding = harText(a.body.buf.Bytes())
+		a.entry.Truncated = a.entry.Truncated || a.body.total > int64(a.body.limit)
+	}
+}
+
+// write stores the session as <dir>/capture-<unix_nano>-<seq>.har, or
+// appends one line per attempt to <dir>/capture-YYYYMMDD.ndjson.
+func (s *captureSession) write() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	entries := s.entries
+	s.mu.Unlock()
+	if len(entries) == 0 {
+		return
+	}
+	go func() {
+		if err := writeCapture(s.cfg, s.file, entries); err != nil {
+			Error("capture write failed", "request_id", s.requestID, "dir", s.cfg.Dir, "err", err)
+		}
+	}()
+}
+
+var (
+	captureMu  sync.Mutex
+	captureSeq uint64
+)
+
+func writeCapture(cfg CaptureConfig, file string, entries []*harEntry) error {
+	if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+		return err
+	}
+	if cfg.Format == "ndjson" {
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		enc.SetEscapeHTML(false)
+		for _, e := range entries {
+			if err := enc.Encode(e); err != nil {
+				return err
+			}
+		}
+		captureMu.Lock()
+		defer captureMu.Unlock()
+		path := filepath.Join(cfg.Dir, "capture-"+time.Now().Format("20060102")+".ndjson")
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = f.Write(buf.Bytes())
+		return err
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(harFile{Log: harLog{
+		Version: "1.2",
+		Creator: harCreator{Name: "krypton", Version: "1"},
+		Entries: entries,
+	}}); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(cfg.Dir, file+".har"), buf.Bytes(), 0o600)
+}
+
+func (s *captureSession) harRequest(r *http.Request) harRequest {
+	u := *r.URL
+	if u.Host == "" {
+		u.Host = r.Host
+	}
+	if u.Scheme == "" {
+		u.Scheme = "http"
+	}
+	req := harRequest{
+		Method:      r.Method,
+		URL:         u.String(),
+		HTTPVersion: r.Proto,
+		Headers:     s.harHeaders(r.Header),
+		QueryString: make([]harHeader, 0),
+		Cookies:     []struct{}{},
+		HeadersSize: -1,
+		BodySize:    requestBytes(r),
+	}
+	for k, vs := range u.Query() {
+		for _, v := range vs {
+			req.QueryString = append(req.QueryString, harHeader{Name: k, Value: v})
+		}
+	}
+	if len(s.body) > 0 {
+		body := s.body
+		if len(body) > s.cfg.MaxBodyBytes {
+			body = body[:s.cfg.MaxBodyBytes]
+		}
+		text, _ := harText(body)
+		req.PostData = &harPostData{MimeType: r.Header.Get("Content-Type"), Text: text}
+	}
+	return req
+}
+
+func (s *captureSession) harHeaders(h http.Header) []harHeader {
+	// redact_headers adds to the defaults; credentials are never written.
+	redact := append(append([]string(nil), defaultCaptureRedact...), s.cfg.RedactHeaders...)
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	out := make([]harHeader, 0, len(h))
+	for _, k := range keys {
+		vs := h[k]
+		hidden := false
+		for _, name := range redact {
+			if strings.EqualFold(k, name) {
+				hidden = true
+				break
+			}
+		}
+		for _, v := range vs {
+			if hidden {
+				v = "<redacted>"
+			}
+			out = append(out, harHeader{Name: k, Value: v})
+		}
+	}
+	return out
+}
+
+// harText returns body as text, or base64 when it is not valid UTF-8.
+func harText(body []byte) (string, string) {
+	if utf8.Valid(body) {
+		return string(body), ""
+	}
+	return base64.StdEncoding.EncodeToString(body), "base64"
+}
+
+type cappedBuffer struct {
+	buf   bytes.Buffer
+	limit int
+	total int64
+}
+
+func (c *cappedBuffer) Write(p []byte) (int, error) {
+	c.total += int64(len(p))
+	if remain := c.limit - c.buf.Len(); remain > 0 {
+		if len(p) > remain {
+			c.buf.Write(p[:remain])
+		} else {
+			c.buf.Write(p)
+		}
+	}
+	return len(p), nil
+}
+
+type harFile struct {
+	Log harLog `json:"log"`
+}
+
+type harLog struct {
+	Version string      `json:"version"`
+	Creator harCreator  `json:"creator"`
+	Entries []*harEntry `json:"entries"`
+}
+
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type harEntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+	Node            string      `json:"_node"`
+	Attempt         int         `json:"_attempt"`
+	RequestID       string      `json:"_request_id"`
+	Error           string      `json:"_error,omitempty"`
+	Truncated       bool        `json:"_truncated,omitempty"`
+}
+
+type harRequest struct {
+	Method      string       `json:"method"`
+	URL         string       `json:"url"`
+	HTTPVersion string       `json:"httpVersion"`
+	Headers     []harHeader  `json:"headers"`
+	QueryString []harHeader  `json:"queryString"`
+	Cookies     []struct{}   `json:"cookies"`
+	HeadersSize int          `json:"headersSize"`
+	BodySize    int64        `json:"bodySize"`
+	PostData    *harPostData `json:"postData,omitempty"`
+}
+
+type harPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type harResponse struct {
+	Status      int         `json:"status"`
+	StatusText  string      `json:"statusText"`
+	HTTPVersion string      `json:"httpVersion"`
+	Headers     []harHeader `json:"headers"`
+	Cookies     []struct{}  `json:"cookies"`
+	Content     harContent  `json:"content"`
+	RedirectURL string      `json:"redirectURL"`
+	HeadersSize int         `json:"headersSize"`
+	BodySize    int64       `json:"bodySize"`
+}
+
+type harContent struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+type harHeader struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
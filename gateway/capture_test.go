@@ -0,0 +1,45 @@
+package gateway
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestCaptureRedactHeaders(t *testing.T) {
+	h := http.Header{}
+	h.Set("Authorization", "Bearer secret")
+	h.Set("Cookie", "session=secret")
+	h.Set("X-Api-Key", "secret")
+	h.Set("Content-Type", "application/json")
+
+	tests := []struct {
+		name   string
+		redact []string
+		hidden []string
+		shown  []string
+	}{
+		{"defaults", nil, []string{"Authorization", "Cookie"}, []string{"X-Api-Key", "Content-Type"}},
+		{"custom list keeps defaults", []string{"X-Api-Key"}, []string{"Authorization", "Cookie", "X-Api-Key"}, []string{"Content-Type"}},
+		{"empty list keeps defaults", []string{}, []string{"Authorization", "Cookie"}, []string{"X-Api-Key", "Content-Type"}},
+		{"case insensitive", []string{"x-api-key"}, []string{"Authorization", "X-Api-Key"}, []string{"Content-Type"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &captureSession{cfg: CaptureConfig{RedactHeaders: tt.redact}}
+			got := make(map[string]string)
+			for _, hh := range s.harHeaders(h) {
+				got[hh.Name] = hh.Value
+			}
+			for _, name := range tt.hidden {
+				if got[name] != "<redacted>" {
+					t.Errorf("%s = %q, want <redacted>", name, got[name])
+				}
+			}
+			for _, name := range tt.shown {
+				if got[name] != h.Get(name) {
+					t.Errorf("%s = %q, want %q", name, got[name], h.Get(name))
+				}
+			}
+		})
+	}
+}
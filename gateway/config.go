@@ -1,42 +1,67 @@
 package gateway
 
 import (
+	"errors"
+	"fmt"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/pelletier/go-toml/v2"
 )
 
 type Config struct {
-	Gateway  GatewayConfig  `toml:"gateway"`
-	Strategy StrategyConfig `toml:"strategy"`
-	Nodes    []NodeConfig   `toml:"nodes"`
+	Gateway   GatewayConfig   `toml:"gateway"`
+	Strategy  StrategyConfig  `toml:"strategy"`
+	Tracing   TracingConfig   `toml:"tracing"`
+	AccessLog AccessLogConfig `toml:"access_log"`
+	Capture   CaptureConfig   `toml:"capture"`
+	Notify    NotifyConfig    `toml:"notify"`
+	Nodes     []NodeConfig    `toml:"nodes"`
 }
 
 type GatewayConfig struct {
-	Listen                string            `toml:"listen"`
-	Shards                int               `toml:"shards"`
-	MaxRetries            int               `toml:"max_retries"`
-	MaxBodySize           int64             `toml:"max_body_size"`
-	RetryNonIdempotent    bool              `toml:"retry_non_idempotent"`
-	AdminAPIEnabled       bool              `toml:"admin_api_enabled"`
-	AdminAPIToken         string            `toml:"admin_api_token"`
-	ReadTimeout           Duration          `toml:"read_timeout"`
-	WriteTimeout          Duration          `toml:"write_timeout"`
-	IdleTimeout           Duration          `toml:"idle_timeout"`
-	ResponseHeaderTimeout Duration          `toml:"response_header_timeout"`
-	IdleConnTimeout       Duration          `toml:"idle_conn_timeout"`
-	UpstreamTimeout       Duration          `toml:"upstream_timeout"`
-	MaxIdleConns          int               `toml:"max_idle_conns"`
-	MaxIdleConnsPerHost   int               `toml:"max_idle_conns_per_host"`
-	MaxConnsPerHost       int               `toml:"max_conns_per_host"`
-	HealthCheckDefault    HealthCheckConfig `toml:"health_check_default"`
-	TriggerScript         string            `toml:"trigger_script"`
-	TriggerTimeout        Duration          `toml:"trigger_timeout"`
-	TriggerBodyLimit      int               `toml:"trigger_body_limit"`
-	OpenAICheckKey        string            `toml:"openai_check_key"`
-	OpenAICheckModel      string            `toml:"openai_check_model"`
-	Retry                 RetryConfig       `toml:"retry"`
+	Listen                  string             `toml:"listen"`
+	LogFormat               string             `toml:"log_format"`
+	Shards                  int                `toml:"shards"`
+	MaxRetries              int                `toml:"max_retries"`
+	MaxBodySize             int64              `toml:"max_body_size"`
+	RetryNonIdempotent      bool               `toml:"retry_non_idempotent"`
+	AttributionHeaders      bool               `toml:"attribution_headers"`
+	AdminAPIEnabled         bool               `toml:"admin_api_enabled"`
+	AdminAPIToken           string             `toml:"admin_api_token"`
+	AdminTokens             []AdminTokenConfig `toml:"admin_tokens"`
+	AdminListen             string             `toml:"admin_listen"`
+	AdminTLSCert            string             `toml:"admin_tls_cert"`
+	AdminTLSKey             string             `toml:"admin_tls_key"`
+	AdminClientCA           string             `toml:"admin_client_ca"`
+	AdminAuditLog           string             `toml:"admin_audit_log"`
+	AdminConfigHistoryDir   string             `toml:"admin_config_history_dir"`
+	AdminConfigHistoryLimit int                `toml:"admin_config_history_limit"`
+	ReadTimeout             Duration           `toml:"read_timeout"`
+	WriteTimeout            Duration           `toml:"write_timeout"`
+	IdleTimeout             Duration           `toml:"idle_timeout"`
+	ResponseHeaderTimeout   Duration           `toml:"response_header_timeout"`
+	IdleConnTimeout         Duration           `toml:"idle_conn_timeout"`
+	UpstreamTimeout         Duration           `toml:"upstream_timeout"`
+	MaxIdleConns            int                `toml:"max_idle_conns"`
+	MaxIdleConnsPerHost     int                `toml:"max_idle_conns_per_host"`
+	MaxConnsPerHost         int                `toml:"max_conns_per_host"`
+	HealthCheckDefault      HealthCheckConfig  `toml:"health_check_default"`
+	TriggerScript           string             `toml:"trigger_script"`
+	TriggerTimeout          Duration           `toml:"trigger_timeout"`
+	TriggerBodyLimit        int                `toml:"trigger_body_limit"`
+	OpenAICheckKey          string             `toml:"openai_check_key"`
+	OpenAICheckModel        string             `toml:"openai_check_model"`
+	Retry                   RetryConfig        `toml:"retry"`
+}
+
+type AdminTokenConfig struct {
+	Name   string   `toml:"name"`
+	Token  string   `toml:"token"`
+	Scopes []string `toml:"scopes"`
 }
 
 type RetryConfig struct {
@@ -49,6 +74,7 @@ type RetryConfig struct {
 }
 
 type StrategyConfig struct {
+	Algorithm               string   `toml:"algorithm"`
 	MinWeight               int32    `toml:"min_weight"`
 	PenaltyFactor           float64  `toml:"penalty_factor"`
 	RecoveryInterval        Duration `toml:"recovery_interval"`
@@ -59,19 +85,85 @@ type StrategyConfig struct {
 	ConnFactorSyncThreshold float64  `toml:"conn_factor_sync_threshold"`
 	ConnFactorEMAAlpha      float64  `toml:"conn_factor_ema_alpha"`
 	HashShard               bool     `toml:"hash_shard"`
+	AffinityKey             string   `toml:"affinity_key"`
+	AffinityLoadFactor      float64  `toml:"affinity_load_factor"`
+	LatencyScoreEnabled     bool     `toml:"latency_score_enabled"`
+	LatencyMetric           string   `toml:"latency_metric"`
+	LatencyEWMAAlpha        float64  `toml:"latency_ewma_alpha"`
+	LatencyMinSamples       int      `toml:"latency_min_samples"`
+	LatencyTolerance        float64  `toml:"latency_tolerance"`
+	LatencySlope            float64  `toml:"latency_slope"`
+	LatencyMinScore         float64  `toml:"latency_min_score"`
+}
+
+type TracingConfig struct {
+	Enabled       bool              `toml:"enabled"`
+	Endpoint      string            `toml:"endpoint"`
+	Headers       map[string]string `toml:"headers"`
+	ServiceName   string            `toml:"service_name"`
+	SampleRate    float64           `toml:"sample_rate"`
+	BatchSize     int               `toml:"batch_size"`
+	QueueSize     int               `toml:"queue_size"`
+	FlushInterval Duration          `toml:"flush_interval"`
+	Timeout       Duration          `toml:"timeout"`
+}
+
+// AccessLogConfig enables the access log when Path is set. Format is
+// common, combined, json, or a template such as "${remote_addr} ${node}".
+type AccessLogConfig struct {
+	Path           string   `toml:"path"`
+	Format         string   `toml:"format"`
+	MaxSizeMB      int      `toml:"max_size_mb"`
+	RotateInterval Duration `toml:"rotate_interval"`
+	MaxBackups     int      `toml:"max_backups"`
+	MaxAge         Duration `toml:"max_age"`
+}
+
+// CaptureConfig selects requests whose upstream attempts are written out in
+// full. Paths and Nodes narrow the selection when set; SampleRate then keeps
+// that fraction of matching requests.
+type CaptureConfig struct {
+	Enabled       bool     `toml:"enabled"`
+	Dir           string   `toml:"dir"`
+	Format        string   `toml:"format"`
+	Paths         []string `toml:"paths"`
+	Nodes         []string `toml:"nodes"`
+	SampleRate    float64  `toml:"sample_rate"`
+	MaxBodyBytes  int      `toml:"max_body_bytes"`
+	RedactHeaders []string `toml:"redact_headers"`
+}
+
+// NotifyConfig posts node transitions to webhooks. A node is degraded once
+// its effective weight drops below DegradedRatio of its configured weight
+// and ejected once it reaches strategy.min_weight.
+type NotifyConfig struct {
+	DegradedRatio float64         `toml:"degraded_ratio"`
+	Webhooks      []WebhookConfig `toml:"webhooks"`
+}
+
+// WebhookConfig is one notification target. Events filters by event type
+// (node_class, node_state, health_status); empty means all.
+type WebhookConfig struct {
+	URL          string            `toml:"url"`
+	Events       []string          `toml:"events"`
+	Headers      map[string]string `toml:"headers"`
+	Timeout      Duration          `toml:"timeout"`
+	MaxRetries   int               `toml:"max_retries"`
+	RetryBackoff Duration          `toml:"retry_backoff"`
 }
 
 type HealthCheckConfig struct {
-	Interval Duration `toml:"interval"`
-	Timeout  Duration `toml:"timeout"`
-	Script   string   `toml:"script"`
+	Interval    Duration `toml:"interval"`
+	Timeout     Duration `toml:"timeout"`
+	Script      string   `toml:"script"`
+	HistorySize int      `toml:"history_size"`
 }
 
 type NodeConfig struct {
-	ID          string `toml:"id"`
-	Address     string `toml:"address"`
-	Weight      int32  `toml:"weight"`
-	CheckScript string `toml:"check_script"`
+	ID          string `toml:"id" json:"id"`
+	Address     string `toml:"address" json:"address"`
+	Weight      int32  `toml:"weight" json:"weight"`
+	CheckScript string `toml:"check_script,omitempty" json:"check_script,omitempty"`
 }
 
 type Duration struct {
@@ -87,6 +179,10 @@ func (d *Duration) UnmarshalText(text []byte) error {
 	return nil
 }
 
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.Duration.String()), nil
+}
+
 func LoadConfig(path string) (*Config, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
@@ -160,6 +256,81 @@ func LoadConfig(path string) (*Config, error) {
 	if cfg.Strategy.ConnFactorEMAAlpha <= 0 || cfg.Strategy.ConnFactorEMAAlpha > 1 {
 		cfg.Strategy.ConnFactorEMAAlpha = 0.2
 	}
+	if cfg.Tracing.Endpoint == "" {
+		cfg.Tracing.Endpoint = "http://127.0.0.1:4318/v1/traces"
+	}
+	if cfg.Tracing.ServiceName == "" {
+		cfg.Tracing.ServiceName = "krypton"
+	}
+	if cfg.Tracing.SampleRate <= 0 || cfg.Tracing.SampleRate > 1 {
+		cfg.Tracing.SampleRate = 1
+	}
+	if cfg.Tracing.BatchSize <= 0 {
+		cfg.Tracing.BatchSize = 512
+	}
+	if cfg.Tracing.QueueSize <= 0 {
+		cfg.Tracing.QueueSize = 4096
+	}
+	if cfg.Tracing.FlushInterval.Duration <= 0 {
+		cfg.Tracing.FlushInterval = Duration{Duration: 5 * time.Second}
+	}
+	if cfg.Tracing.Timeout.Duration <= 0 {
+		cfg.Tracing.Timeout = Duration{Duration: 10 * time.Second}
+	}
+	if cfg.AccessLog.Format == "" {
+		cfg.AccessLog.Format = "combined"
+	}
+	if cfg.AccessLog.MaxSizeMB < 0 {
+		cfg.AccessLog.MaxSizeMB = 0
+	}
+	if cfg.Capture.Dir == "" {
+		cfg.Capture.Dir = "captures"
+	}
+	if cfg.Capture.Format == "" {
+		cfg.Capture.Format = "har"
+	}
+	if cfg.Capture.SampleRate <= 0 || cfg.Capture.SampleRate > 1 {
+		cfg.Capture.SampleRate = 1
+	}
+	if cfg.Capture.MaxBodyBytes <= 0 {
+		cfg.Capture.MaxBodyBytes = 64 << 10
+	}
+	if cfg.Notify.DegradedRatio <= 0 || cfg.Notify.DegradedRatio > 1 {
+		cfg.Notify.DegradedRatio = 0.8
+	}
+	for i := range cfg.Notify.Webhooks {
+		wh := &cfg.Notify.Webhooks[i]
+		if wh.Timeout.Duration <= 0 {
+			wh.Timeout = Duration{Duration: 5 * time.Second}
+		}
+		if wh.MaxRetries < 0 {
+			wh.MaxRetries = 0
+		}
+		if wh.RetryBackoff.Duration <= 0 {
+			wh.RetryBackoff = Duration{Duration: time.Second}
+		}
+	}
+	if cfg.Strategy.AffinityLoadFactor < 1 {
+		cfg.Strategy.AffinityLoadFactor = 1.25
+	}
+	if cfg.Strategy.LatencyMetric == "" {
+		cfg.Strategy.LatencyMetric = "ttfb"
+	}
+	if cfg.Strategy.LatencyEWMAAlpha <= 0 || cfg.Strategy.LatencyEWMAAlpha > 1 {
+		cfg.Strategy.LatencyEWMAAlpha = 0.2
+	}
+	if cfg.Strategy.LatencyMinSamples <= 0 {
+		cfg.Strategy.LatencyMinSamples = 20
+	}
+	if cfg.Strategy.LatencyTolerance < 1 {
+		cfg.Strategy.LatencyTolerance = 1.5
+	}
+	if cfg.Strategy.LatencySlope <= 0 {
+		cfg.Strategy.LatencySlope = 40
+	}
+	if cfg.Strategy.LatencyMinScore <= 0 || cfg.Strategy.LatencyMinScore > 100 {
+		cfg.Strategy.LatencyMinScore = 30
+	}
 	if cfg.Strategy.RecoveryInterval.Duration <= 0 {
 		cfg.Strategy.RecoveryInterval = Duration{Duration: 10 * time.Second}
 	}
@@ -171,3 +342,183 @@ func LoadConfig(path string) (*Config, error) {
 	}
 	return &cfg, nil
 }
+
+// SaveConfig writes cfg to path, replacing the file atomically. The whole
+// file is rewritten: comments are not preserved and defaults are written
+// out. An existing file keeps its permissions.
+func SaveConfig(path string, cfg *Config) error {
+	data, err := toml.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	if info, err := os.Stat(path); err == nil {
+		if err := tmp.Chmod(info.Mode().Perm()); err != nil {
+			_ = tmp.Close()
+			_ = os.Remove(tmp.Name())
+			return err
+		}
+	}
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func validateNodeConfig(nc NodeConfig) error {
+	if nc.ID == "" {
+		return errors.New("node id required")
+	}
+	if nc.Weight <= 0 {
+		return fmt.Errorf("node %s: weight must be positive", nc.ID)
+	}
+	u, err := url.Parse(nc.Address)
+	if err != nil {
+		return fmt.Errorf("node %s: %w", nc.ID, err)
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("node %s: address must be an absolute URL", nc.ID)
+	}
+	return nil
+}
+
+// validateConfig reports problems that LoadConfig's defaulting cannot fix.
+// An empty result means the config can be applied.
+func validateConfig(cfg *Config) []string {
+	var errs []string
+	gw := cfg.Gateway
+	if gw.Listen == "" {
+		errs = append(errs, "gateway.listen is required")
+	}
+	switch gw.LogFormat {
+	case "", "text", "json":
+	default:
+		errs = append(errs, fmt.Sprintf("gateway.log_format: unknown format %q (text or json)", gw.LogFormat))
+	}
+	if _, err := newStrategy(cfg.Strategy.Algorithm); err != nil {
+		errs = append(errs, fmt.Sprintf("strategy.algorithm: %v (%s)", err, strings.Join(strategyNames, ", ")))
+	}
+	if err := checkRingHash(cfg.Strategy, cfg.Gateway.Shards); err != nil {
+		errs = append(errs, fmt.Sprintf("strategy.algorithm: %v", err))
+	}
+	if err := validateAffinityKey(cfg.Strategy.AffinityKey); err != nil {
+		errs = append(errs, fmt.Sprintf("strategy.affinity_key: %v", err))
+	}
+	switch cfg.Strategy.LatencyMetric {
+	case "", "ttfb", "total":
+	default:
+		errs = append(errs, fmt.Sprintf("strategy.latency_metric: unknown metric %q (ttfb or total)", cfg.Strategy.LatencyMetric))
+	}
+	switch cfg.Capture.Format {
+	case "", "har", "ndjson":
+	default:
+		errs = append(errs, fmt.Sprintf("capture.format: unknown format %q (har or ndjson)", cfg.Capture.Format))
+	}
+	for i, wh := range cfg.Notify.Webhooks {
+		if u, err := url.Parse(wh.URL); err != nil || u.Scheme == "" || u.Host == "" {
+			errs = append(errs, fmt.Sprintf("notify.webhooks[%d]: url must be an absolute URL", i))
+		}
+		for _, e := range wh.Events {
+			switch e {
+			case webhookNodeClass, webhookNodeState, webhookHealthStatus:
+			default:
+				errs = append(errs, fmt.Sprintf("notify.webhooks[%d]: unknown event %q", i, e))
+			}
+		}
+	}
+	if gw.AdminAPIEnabled && gw.AdminAPIToken == "" && len(gw.AdminTokens) == 0 {
+		errs = append(errs, "gateway.admin_api_enabled requires admin_api_token or admin_tokens")
+	}
+	names := make(map[string]bool)
+	for i, t := range gw.AdminTokens {
+		if t.Token == "" {
+			errs = append(errs, fmt.Sprintf("gateway.admin_tokens[%d]: token is required", i))
+		}
+		if t.Name != "" {
+			if names[t.Name] {
+				errs = append(errs, fmt.Sprintf("gateway.admin_tokens[%d]: duplicate name %q", i, t.Name))
+			}
+			names[t.Name] = true
+		}
+		for _, scope := range t.Scopes {
+			if scope != scopeRead && scope != scopeWrite && scope != scopeConfig {
+				errs = append(errs, fmt.Sprintf("gateway.admin_tokens[%d]: unknown scope %q", i, scope))
+			}
+		}
+	}
+	scripts := [][2]string{
+		{"gateway.health_check_default.script", gw.HealthCheckDefault.Script},
+		{"gateway.trigger_script", gw.TriggerScript},
+	}
+	for _, sc := range scripts {
+		if sc[1] == "" {
+			continue
+		}
+		if _, err := os.Stat(sc[1]); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", sc[0], err))
+		}
+	}
+
+	ids := make(map[string]bool, len(cfg.Nodes))
+	for i, nc := range cfg.Nodes {
+		if err := validateNodeConfig(nc); err != nil {
+			errs = append(errs, fmt.Sprintf("nodes[%d]: %v", i, err))
+		}
+		if nc.ID != "" {
+			if ids[nc.ID] {
+				errs = append(errs, fmt.Sprintf("nodes[%d]: duplicate node id %q", i, nc.ID))
+			}
+			ids[nc.ID] = true
+		}
+		if nc.CheckScript != "" {
+			if _, err := os.Stat(nc.CheckScript); err != nil {
+				errs = append(errs, fmt.Sprintf("nodes[%d].check_script: %v", i, err))
+			}
+		}
+	}
+	return errs
+}
+
+// restartOnlyFields are read once at startup; reloading a change to them has
+// no effect until the process restarts. A trailing "." covers a whole section.
+var restartOnlyFields = []string{
+	"gateway.listen",
+	"gateway.log_format",
+	"gateway.shards",
+	"gateway.admin_listen",
+	"gateway.admin_tls_cert",
+	"gateway.admin_tls_key",
+	"gateway.admin_client_ca",
+	"gateway.health_check_default.interval",
+	"tracing.",
+	"access_log.",
+}
+
+func restartWarnings(changes []ConfigChange) []string {
+	out := make([]string, 0)
+	for _, c := range changes {
+		for _, f := range restartOnlyFields {
+			if c.Field == f || (strings.HasSuffix(f, ".") && strings.HasPrefix(c.Field, f)) {
+				out = append(out, c.Field+" only takes effect after a restart")
+			}
+		}
+	}
+	return out
+}
+
+type configValidationError struct {
+	Errors []string
+}
+
+func (e *configValidationError) Error() string {
+	return "invalid config: " + strings.Join(e.Errors, "; ")
+}
@@ -0,0 +1,122 @@
+package gateway
+
+import (
+	"net/url"
+	"reflect"
+	"strings"
+)
+
+type ConfigChange struct {
+	Field  string      `json:"field"`
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+var durationType = reflect.TypeOf(Duration{})
+
+// secretConfigFields are never written out in diffs.
+var secretConfigFields = map[string]bool{
+	"gateway.admin_api_token":  true,
+	"gateway.openai_check_key": true,
+	"tracing.headers":          true,
+}
+
+// diffConfig lists every field that differs between two configs, keyed by
+// its TOML path. Nodes are matched by id.
+func diffConfig(before, after *Config) []ConfigChange {
+	out := make([]ConfigChange, 0)
+	diffStruct("gateway", reflect.ValueOf(before.Gateway), reflect.ValueOf(after.Gateway), &out)
+	diffStruct("strategy", reflect.ValueOf(before.Strategy), reflect.ValueOf(after.Strategy), &out)
+	diffStruct("tracing", reflect.ValueOf(before.Tracing), reflect.ValueOf(after.Tracing), &out)
+	diffStruct("access_log", reflect.ValueOf(before.AccessLog), reflect.ValueOf(after.AccessLog), &out)
+	diffStruct("capture", reflect.ValueOf(before.Capture), reflect.ValueOf(after.Capture), &out)
+	diffStruct("notify", reflect.ValueOf(before.Notify), reflect.ValueOf(after.Notify), &out)
+	out = append(out, diffNodes(before.Nodes, after.Nodes)...)
+	return out
+}
+
+func diffStruct(prefix string, a, b reflect.Value, out *[]ConfigChange) {
+	t := a.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("toml"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		key := prefix + "." + name
+		av, bv := a.Field(i), b.Field(i)
+		if f.Type.Kind() == reflect.Struct && f.Type != durationType {
+			diffStruct(key, av, bv, out)
+			continue
+		}
+		if reflect.DeepEqual(av.Interface(), bv.Interface()) {
+			continue
+		}
+		*out = append(*out, ConfigChange{
+			Field:  key,
+			Before: diffValue(key, av),
+			After:  diffValue(key, bv),
+		})
+	}
+}
+
+func diffValue(key string, v reflect.Value) interface{} {
+	if secretConfigFields[key] {
+		if v.IsZero() {
+			return ""
+		}
+		return "<redacted>"
+	}
+	switch x := v.Interface().(type) {
+	case Duration:
+		return x.Duration.String()
+	case []AdminTokenConfig:
+		names := make([]string, 0, len(x))
+		for _, t := range x {
+			names = append(names, t.Name+":"+strings.Join(t.Scopes, "|"))
+		}
+		return names
+	case []WebhookConfig:
+		urls := make([]string, 0, len(x))
+		for _, wh := range x {
+			urls = append(urls, redactURL(wh.URL))
+		}
+		return urls
+	default:
+		return x
+	}
+}
+
+// redactURL keeps only scheme://host; webhook URLs often carry a token in
+// the path or query.
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "<invalid>"
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+func diffNodes(before, after []NodeConfig) []ConfigChange {
+	out := make([]ConfigChange, 0)
+	prev := make(map[string]NodeConfig, len(before))
+	for _, nc := range before {
+		prev[nc.ID] = nc
+	}
+	seen := make(map[string]bool, len(after))
+	for _, nc := range after {
+		seen[nc.ID] = true
+		old, ok := prev[nc.ID]
+		if !ok {
+			out = append(out, ConfigChange{Field: "nodes." + nc.ID, Before: nil, After: nc})
+			continue
+		}
+		diffStruct("nodes."+nc.ID, reflect.ValueOf(old), reflect.ValueOf(nc), &out)
+	}
+	for _, nc := range before {
+		if !seen[nc.ID] {
+			out = append(out, ConfigChange{Field: "nodes." + nc.ID, Before: nc, After: nil})
+		}
+	}
+	return out
+}
@@ -0,0 +1,137 @@
+package gateway
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func validTestConfig() *Config {
+	cfg := &Config{Nodes: []NodeConfig{
+		{ID: "a", Address: "http://127.0.0.1:9001", Weight: 100},
+		{ID: "b", Address: "http://127.0.0.1:9002", Weight: 100},
+	}}
+	cfg.Gateway.Listen = ":8080"
+	cfg.Gateway.Shards = 2
+	cfg.Strategy.Algorithm = "swrr"
+	return cfg
+}
+
+func TestValidateConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*Config)
+		want   string
+	}{
+		{"valid", func(*Config) {}, ""},
+		{"missing listen", func(c *Config) { c.Gateway.Listen = "" }, "gateway.listen is required"},
+		{"unknown algorithm", func(c *Config) { c.Strategy.Algorithm = "fastest" }, "strategy.algorithm"},
+		{"ring_hash without hash_shard", func(c *Config) { c.Strategy.Algorithm = "ring_hash" }, "requires strategy.hash_shard"},
+		{"ring_hash with hash_shard", func(c *Config) {
+			c.Strategy.Algorithm = "ring_hash"
+			c.Strategy.HashShard = true
+		}, ""},
+		{"ring_hash on one shard", func(c *Config) {
+			c.Strategy.Algorithm = "ring_hash"
+			c.Gateway.Shards = 1
+		}, ""},
+		{"bad affinity key", func(c *Config) { c.Strategy.AffinityKey = "query:user" }, "strategy.affinity_key"},
+		{"bad latency metric", func(c *Config) { c.Strategy.LatencyMetric = "p99" }, "strategy.latency_metric"},
+		{"bad log format", func(c *Config) { c.Gateway.LogFormat = "xml" }, "gateway.log_format"},
+		{"bad capture format", func(c *Config) { c.Capture.Format = "pcap" }, "capture.format"},
+		{"relative webhook url", func(c *Config) {
+			c.Notify.Webhooks = []WebhookConfig{{URL: "/hook"}}
+		}, "notify.webhooks[0]: url"},
+		{"unknown webhook event", func(c *Config) {
+			c.Notify.Webhooks = []WebhookConfig{{URL: "http://127.0.0.1/hook", Events: []string{"node.deleted"}}}
+		}, "unknown event"},
+		{"admin api without token", func(c *Config) { c.Gateway.AdminAPIEnabled = true }, "requires admin_api_token"},
+		{"unknown token scope", func(c *Config) {
+			c.Gateway.AdminTokens = []AdminTokenConfig{{Name: "x", Token: "t", Scopes: []string{"admin"}}}
+		}, `unknown scope "admin"`},
+		{"duplicate token name", func(c *Config) {
+			c.Gateway.AdminTokens = []AdminTokenConfig{{Name: "x", Token: "t1"}, {Name: "x", Token: "t2"}}
+		}, "duplicate name"},
+		{"missing script", func(c *Config) { c.Gateway.TriggerScript = "/nonexistent/trigger.sh" }, "gateway.trigger_script"},
+		{"zero node weight", func(c *Config) { c.Nodes[1].Weight = 0 }, "nodes[1]: node b: weight must be positive"},
+		{"relative node address", func(c *Config) { c.Nodes[0].Address = "/v1" }, "node a: address must be an absolute URL"},
+		{"missing node id", func(c *Config) { c.Nodes[0].ID = "" }, "node id required"},
+		{"duplicate node id", func(c *Config) { c.Nodes[1].ID = "a" }, `duplicate node id "a"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validTestConfig()
+			tt.modify(cfg)
+			errs := validateConfig(cfg)
+			if tt.want == "" {
+				if len(errs) != 0 {
+					t.Fatalf("errors = %q, want none", errs)
+				}
+				return
+			}
+			if len(errs) == 0 {
+				t.Fatalf("no errors, want %q", tt.want)
+			}
+			if !strings.Contains(strings.Join(errs, "; "), tt.want) {
+				t.Errorf("errors = %q, want one containing %q", errs, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiffConfigRestartWarnings(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*Config)
+		fields []string
+		warn   bool
+	}{
+		{"no change", func(*Config) {}, nil, false},
+		{"listen", func(c *Config) { c.Gateway.Listen = ":9090" }, []string{"gateway.listen"}, true},
+		{"shards", func(c *Config) { c.Gateway.Shards = 4 }, []string{"gateway.shards"}, true},
+		{"tracing section", func(c *Config) { c.Tracing.Endpoint = "http://collector:4318/v1/traces" }, []string{"tracing.endpoint"}, true},
+		{"access log section", func(c *Config) { c.AccessLog.Path = "access.log" }, []string{"access_log.path"}, true},
+		{"min weight", func(c *Config) { c.Strategy.MinWeight = 5 }, []string{"strategy.min_weight"}, false},
+		{"node weight", func(c *Config) { c.Nodes[0].Weight = 50 }, []string{"nodes.a.weight"}, false},
+		{"node added", func(c *Config) {
+			c.Nodes = append(c.Nodes, NodeConfig{ID: "c", Address: "http://127.0.0.1:9003", Weight: 100})
+		}, []string{"nodes.c"}, false},
+		{"node removed", func(c *Config) { c.Nodes = c.Nodes[:1] }, []string{"nodes.b"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := validTestConfig()
+			after := validTestConfig()
+			tt.modify(after)
+			changes := diffConfig(before, after)
+			var fields []string
+			for _, c := range changes {
+				fields = append(fields, c.Field)
+			}
+			if !reflect.DeepEqual(fields, tt.fields) {
+				t.Errorf("changed fields = %q, want %q", fields, tt.fields)
+			}
+			warnings := restartWarnings(changes)
+			if got := len(warnings) > 0; got != tt.warn {
+				t.Errorf("restart warnings = %q, want warning %v", warnings, tt.warn)
+			}
+		})
+	}
+}
+
+func TestDiffConfigRedactsSecrets(t *testing.T) {
+	before := validTestConfig()
+	after := validTestConfig()
+	after.Gateway.AdminAPIToken = "s3cret"
+	after.Notify.Webhooks = []WebhookConfig{{URL: "https://hooks.example.com/T000/s3cret?token=s3cret"}}
+	changes := diffConfig(before, after)
+	if len(changes) != 2 {
+		t.Fatalf("changes = %+v, want 2", changes)
+	}
+	for _, c := range changes {
+		if strings.Contains(fmt.Sprint(c.After), "s3cret") {
+			t.Errorf("%s leaks a secret: %v", c.Field, c.After)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package gateway
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	eventNode   = "node"
+	eventHealth = "health"
+	eventRetry  = "retry"
+
+	eventRecentLimit = 100
+	eventSubBuffer   = 256
+	eventQueueLimit  = 65536
+)
+
+type Event struct {
+	Type string      `json:"type"`
+	Time time.Time   `json:"time"`
+	Node string      `json:"node"`
+	Data interface{} `json:"data"`
+}
+
+type NodeEvent struct {
+	EffectiveWeight int32   `json:"effective_weight"`
+	InitialWeight   int32   `json:"initial_weight"`
+	PassiveScore    float64 `json:"passive_score"`
+	ActiveScore     float64 `json:"active_score"`
+	Inflight        int32   `json:"inflight"`
+	State           string  `json:"state"`
+}
+
+type RetryEvent struct {
+	RequestID string `json:"request_id"`
+	Attempt   int    `json:"attempt"`
+	Total     int    `json:"total"`
+	Reason    string `json:"reason"`
+	Method    string `json:"method"`
+	Path      string `json:"path"`
+}
+
+// eventHub fans balancer state changes out to subscribers such as the
+// dashboard feed. Publishing never blocks: a channel subscriber that falls
+// behind loses events rather than slowing down request handling, while a
+// queue subscriber buffers them (up to eventQueueLimit) for consumers that
+// must see every transition.
+type eventHub struct {
+	mu     sync.Mutex
+	subs   map[chan Event]struct{}
+	queues map[*eventQueue]struct{}
+	recent []Event
+	active int32
+}
+
+func newEventHub() *eventHub {
+	return &eventHub{subs: make(map[chan Event]struct{}), queues: make(map[*eventQueue]struct{})}
+}
+
+type eventQueue struct {
+	mu      sync.Mutex
+	events  []Event
+	dropped uint64
+	wake    chan struct{}
+}
+
+func (q *eventQueue) push(ev Event) {
+	q.mu.Lock()
+	if len(q.events) >= eventQueueLimit {
+		q.events = q.events[1:]
+		q.dropped++
+	}
+	q.events = append(q.events, ev)
+	q.mu.Unlock()
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Wait returns a channel that is signalled when events are pending.
+func (q *eventQueue) Wait() <-chan struct{} {
+	return q.wake
+}
+
+// Drain returns the pending events, oldest first, and how many were
+// dropped because the queue was full.
+func (q *eventQueue) Drain() ([]Event, uint64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	events, dropped := q.events, q.dropped
+	q.events, q.dropped = nil, 0
+	return events, dropped
+}
+
+func (h *eventHub) SubscribeQueue() *eventQueue {
+	q := &eventQueue{wake: make(chan struct{}, 1)}
+	h.mu.Lock()
+	h.queues[q] = struct{}{}
+	atomic.StoreInt32(&h.active, int32(len(h.subs)+len(h.queues)))
+	h.mu.Unlock()
+	return q
+}
+
+func (h *eventHub) UnsubscribeQueue(q *eventQueue) {
+	h.mu.Lock()
+	delete(h.queues, q)
+	atomic.StoreInt32(&h.active, int32(len(h.subs)+len(h.queues)))
+	h.mu.Unlock()
+}
+
+func (h *eventHub) Subscribe() chan Event {
+	ch := make(chan Event, eventSubBuffer)
+	h.mu.Lock()
+	h.subs[ch] = struct{}{}
+	atomic.StoreInt32(&h.active, int32(len(h.subs)+len(h.queues)))
+	h.mu.Unlock()
+	return ch
+}
+
+func (h *eventHub) Unsubscribe(ch chan Event) {
+	h.mu.Lock()
+	delete(h.subs, ch)
+	atomic.StoreInt32(&h.active, int32(len(h.subs)+len(h.queues)))
+	h.mu.Unlock()
+}
+
+// Recent returns the last health and retry events, oldest first.
+func (h *eventHub) Recent() []Event {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]Event(nil), h.recent...)
+}
+
+func (h *eventHub) publish(ev Event) {
+	if h == nil {
+		return
+	}
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	keep := ev.Type != eventNode
+	if !keep && atomic.LoadInt32(&h.active) == 0 {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if keep {
+		h.recent = append(h.recent, ev)
+		if len(h.recent) > eventRecentLimit {
+			h.recent = append(h.recent[:0], h.recent[len(h.recent)-eventRecentLimit:]...)
+		}
+	}
+	for ch := range h.subs {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+	for q := range h.queues {
+		q.push(ev)
+	}
+}
+
+func (h *eventHub) publishNode(n *Node) {
+	if h == nil || atomic.LoadInt32(&h.active) == 0 {
+		return
+	}
+	h.publish(Event{
+		Type: eventNode,
+		Node: n.ID,
+		Data: NodeEvent{
+			EffectiveWeight: atomic.LoadInt32(&n.effectiveWeight),
+			InitialWeight:   n.InitialWeight,
+			PassiveScore:    n.PassiveScore(),
+			ActiveScore:     n.ActiveScore(),
+			Inflight:        atomic.LoadInt32(&n.inflight),
+			State:           n.State().String(),
+		},
+	})
+}
@@ -11,10 +11,18 @@ import (
 )
 
 type HealthResult struct {
-	Score   int32
-	Status  string
-	Message string
-	Labels  map[string]string
+	Score   int32             `json:"score"`
+	Status  string            `json:"status"`
+	Message string            `json:"message,omitempty"`
+	Labels  map[string]string `json:"labels,omitempty"`
+}
+
+// HealthRecord is one completed health check run for a node.
+type HealthRecord struct {
+	HealthResult
+	Time       time.Time `json:"time"`
+	DurationMs int64     `json:"duration_ms"`
+	Error      string    `json:"error,omitempty"`
 }
 
 type HealthChecker struct {
@@ -54,33 +62,57 @@ func (h *HealthChecker) runOnce(ctx context.Context) {
 			defer wg.Done()
 			defer func() { <-sem }()
 
-			checkCfg := h.cfg.Gateway.HealthCheckDefault
-			if node.checkScript != "" {
-				checkCfg.Script = node.checkScript
+			checkCfg := healthCheckConfigFor(h.cfg, node)
+			start := time.Now()
+			spanCtx, span := startSpan(ctx, "krypton.health_check", spanKindInternal)
+			span.SetAttr("krypton.node.id", node.ID)
+			result, err := runStarlarkCheck(spanCtx, checkCfg, node, h.cfg)
+			span.SetAttr("krypton.health.score", result.Score)
+			span.SetAttr("krypton.health.status", result.Status)
+			span.SetError(err)
+			span.End()
+			record := &HealthRecord{
+				HealthResult: result,
+				Time:         start,
+				DurationMs:   time.Since(start).Milliseconds(),
 			}
-			score, err := runStarlarkCheck(ctx, checkCfg, node, h.cfg)
 			if err != nil {
+				record.Error = err.Error()
 				if errors.Is(err, context.DeadlineExceeded) {
-					Warnf("health check timeout node=%s err=%v", node.ID, err)
+					Warn("health check timeout", "node", node.ID, "err", err)
 				} else {
-					Warnf("health check error node=%s err=%v", node.ID, err)
+					Warn("health check error", "node", node.ID, "err", err)
 				}
 			}
-			node.SetActiveScore(score)
+			Debug("health check result", "node", node.ID, "status", result.Status, "score", result.Score, "message", result.Message, "duration_ms", record.DurationMs)
+			node.lastHealth.Store(record)
+			node.history.add(*record)
+			h.balancer.metrics.healthLatency.observe(time.Since(start), node.ID)
+			h.balancer.metrics.healthChecks.inc(node.ID, result.Status)
+			h.balancer.events.publish(Event{Type: eventHealth, Time: record.Time, Node: node.ID, Data: record})
+			node.SetActiveScore(result.Score)
 			node.SyncWeight(node.PassiveScore(), node.ActiveScore(), node.ConnDelta())
-			Infof("health check ok node=%s score=%d passive=%.0f active=%.0f", node.ID, score, node.PassiveScore(), node.ActiveScore())
+			Info("health check ok", "node", node.ID, "score", result.Score, "passive", node.PassiveScore(), "active", node.ActiveScore())
 		}(n)
 	})
 
 	wg.Wait()
 }
 
-func runStarlarkCheck(ctx context.Context, cfg HealthCheckConfig, n *Node, fullCfg *Config) (int32, error) {
+func healthCheckConfigFor(cfg *Config, n *Node) HealthCheckConfig {
+	checkCfg := cfg.Gateway.HealthCheckDefault
+	if n.checkScript != "" {
+		checkCfg.Script = n.checkScript
+	}
+	return checkCfg
+}
+
+func runStarlarkCheck(ctx context.Context, cfg HealthCheckConfig, n *Node, fullCfg *Config) (HealthResult, error) {
 	if cfg.Script == "" {
-		return 100, nil
+		return HealthResult{Score: 100, Status: "healthy"}, nil
 	}
 	if _, err := os.Stat(cfg.Script); err != nil {
-		return 100, err
+		return HealthResult{Score: 100, Status: "error"}, err
 	}
 
 	timeout := cfg.Timeout.Duration
@@ -89,6 +121,7 @@ func runStarlarkCheck(ctx context.Context, cfg HealthCheckConfig, n *Node, fullC
 	}
 
 	thread := &starlark.Thread{Name: "health_check"}
+	attachScriptLog(ctx, thread)
 	done := make(chan error, 1)
 	var result HealthResult
 
@@ -108,10 +141,11 @@ func runStarlarkCheck(ctx context.Context, cfg HealthCheckConfig, n *Node, fullC
 			done <- errors.New("check() not found")
 			return
 		}
-		nodeCtx := starlark.NewDict(4)
+		nodeCtx := starlark.NewDict(5)
 		_ = nodeCtx.SetKey(starlark.String("id"), starlark.String(n.ID))
 		_ = nodeCtx.SetKey(starlark.String("address"), starlark.String(n.Address))
 		_ = nodeCtx.SetKey(starlark.String("weight"), starlark.MakeInt(int(n.InitialWeight)))
+		_ = nodeCtx.SetKey(starlark.String("history"), starlarkHealthHistory(n.history.List()))
 
 		v, err := starlark.Call(thread, fn, starlark.Tuple{nodeCtx}, nil)
 		if err != nil {
@@ -125,15 +159,15 @@ func runStarlarkCheck(ctx context.Context, cfg HealthCheckConfig, n *Node, fullC
 	select {
 	case <-ctx.Done():
 		thread.Cancel(ctx.Err().Error())
-		return 100, ctx.Err()
+		return HealthResult{Score: 100, Status: "error"}, ctx.Err()
 	case err := <-done:
 		if err != nil {
-			return 100, err
+			return HealthResult{Score: 100, Status: "error"}, err
 		}
-		return result.Score, nil
+		return result, nil
 	case <-time.After(timeout):
 		thread.Cancel("health check timeout")
-		return 0, context.DeadlineExceeded
+		return HealthResult{Score: 0, Status: "timeout"}, context.DeadlineExceeded
 	}
 }
 
@@ -0,0 +1,97 @@
+package gateway
+
+import (
+	"sync"
+
+	"go.starlark.net/starlark"
+)
+
+const defaultHealthHistorySize = 20
+
+// healthHistory is a fixed-size ring of the most recent health check
+// records for one node.
+type healthHistory struct {
+	mu      sync.Mutex
+	records []HealthRecord
+	next    int
+	full    bool
+}
+
+func newHealthHistory(size int) *healthHistory {
+	if size <= 0 {
+		size = defaultHealthHistorySize
+	}
+	return &healthHistory{records: make([]HealthRecord, size)}
+}
+
+func (h *healthHistory) add(rec HealthRecord) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.records[h.next] = rec
+	h.next = (h.next + 1) % len(h.records)
+	if h.next == 0 {
+		h.full = true
+	}
+}
+
+// List returns the records oldest first.
+func (h *healthHistory) List() []HealthRecord {
+	out := make([]HealthRecord, 0)
+	if h == nil {
+		return out
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.full {
+		out = append(out, h.records[h.next:]...)
+	}
+	return append(out, h.records[:h.next]...)
+}
+
+// resize keeps the newest records that still fit.
+func (h *healthHistory) resize(size int) {
+	if h == nil {
+		return
+	}
+	if size <= 0 {
+		size = defaultHealthHistorySize
+	}
+	list := h.List()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if size == len(h.records) {
+		return
+	}
+	if len(list) > size {
+		list = list[len(list)-size:]
+	}
+	h.records = make([]HealthRecord, size)
+	copy(h.records, list)
+	h.next = len(list) % size
+	h.full = len(list) == size
+}
+
+// starlarkHealthHistory converts records into the list passed to check()
+// as node_ctx["history"], oldest first.
+func starlarkHealthHistory(records []HealthRecord) *starlark.List {
+	items := make([]starlark.Value, 0, len(records))
+	for _, rec := range records {
+		labels := starlark.NewDict(len(rec.Labels))
+		for k, v := range rec.Labels {
+			_ = labels.SetKey(starlark.String(k), starlark.String(v))
+		}
+		d := starlark.NewDict(7)
+		_ = d.SetKey(starlark.String("time"), starlark.Float(float64(rec.Time.UnixMilli())/1000))
+		_ = d.SetKey(starlark.String("score"), starlark.MakeInt(int(rec.Score)))
+		_ = d.SetKey(starlark.String("status"), starlark.String(rec.Status))
+		_ = d.SetKey(starlark.String("message"), starlark.String(rec.Message))
+		_ = d.SetKey(starlark.String("labels"), labels)
+		_ = d.SetKey(starlark.String("duration_ms"), starlark.MakeInt64(rec.DurationMs))
+		_ = d.SetKey(starlark.String("error"), starlark.String(rec.Error))
+		items = append(items, d)
+	}
+	return starlark.NewList(items)
+}
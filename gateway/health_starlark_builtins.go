@@ -145,7 +145,8 @@ func MakeLogModule() starlark.Value {
 			if err := starlark.UnpackArgs("log.info", args, kwargs, "msg", &msg); err != nil {
 				return starlark.None, err
 			}
-			Infof("%s", msg)
+			captureScriptLog(thread, "info", msg)
+			Info(msg)
 			return starlark.None, nil
 		}),
 		"warn": starlark.NewBuiltin("log.warn", func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
@@ -153,7 +154,8 @@ func MakeLogModule() starlark.Value {
 			if err := starlark.UnpackArgs("log.warn", args, kwargs, "msg", &msg); err != nil {
 				return starlark.None, err
 			}
-			Warnf("%s", msg)
+			captureScriptLog(thread, "warn", msg)
+			Warn(msg)
 			return starlark.None, nil
 		}),
 		"error": starlark.NewBuiltin("log.error", func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
@@ -161,7 +163,8 @@ func MakeLogModule() starlark.Value {
 			if err := starlark.UnpackArgs("log.error", args, kwargs, "msg", &msg); err != nil {
 				return starlark.None, err
 			}
-			Errorf("%s", msg)
+			captureScriptLog(thread, "error", msg)
+			Error(msg)
 			return starlark.None, nil
 		}),
 	})
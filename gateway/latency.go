@@ -0,0 +1,141 @@
+package gateway
+
+import (
+	"context"
+	"math"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// observeLatency folds one successful attempt into the node's EWMA total
+// latency and time to first byte.
+func (n *Node) observeLatency(total, ttfb time.Duration, alpha float64) {
+	if alpha <= 0 || alpha > 1 {
+		alpha = 0.2
+	}
+	ewmaStore(&n.latencyBits, float64(total.Microseconds())/1000, alpha)
+	ewmaStore(&n.ttfbBits, float64(ttfb.Microseconds())/1000, alpha)
+	atomic.AddUint32(&n.latencySamples, 1)
+}
+
+func ewmaStore(bits *uint64, sample, alpha float64) {
+	for {
+		oldBits := atomic.LoadUint64(bits)
+		old := math.Float64frombits(oldBits)
+		next := sample
+		if old > 0 {
+			next = old + alpha*(sample-old)
+		}
+		if atomic.CompareAndSwapUint64(bits, oldBits, math.Float64bits(next)) {
+			return
+		}
+	}
+}
+
+// LatencyEWMA returns the node's smoothed latency in milliseconds, or 0
+// before the first successful attempt.
+func (n *Node) LatencyEWMA() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&n.latencyBits))
+}
+
+// TTFBEWMA returns the node's smoothed time to first byte in milliseconds.
+func (n *Node) TTFBEWMA() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&n.ttfbBits))
+}
+
+func (n *Node) LatencyScore() float64 {
+	return float64(atomic.LoadInt32(&n.latencyScore))
+}
+
+// RunLatencyScores recomputes latency scores every recovery_interval until
+// ctx is cancelled; requests only feed the EWMAs.
+func (b *Balancer) RunLatencyScores(ctx context.Context) {
+	b.cfgMu.RLock()
+	interval := b.config.Strategy.RecoveryInterval.Duration
+	b.cfgMu.RUnlock()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			b.updateLatencyScores()
+		}
+	}
+}
+
+func (b *Balancer) updateLatencyScores() {
+	b.cfgMu.RLock()
+	defer b.cfgMu.RUnlock()
+	if !b.config.Strategy.LatencyScoreEnabled {
+		return
+	}
+	b.updateLatencyScoresLocked()
+}
+
+// updateLatencyScoresLocked compares every node's EWMA against the pool
+// median. A node within latency_tolerance times the median keeps 100; past
+// that it loses latency_slope points per extra multiple of the median, down
+// to latency_min_score.
+func (b *Balancer) updateLatencyScoresLocked() {
+	st := b.config.Strategy
+	var nodes []*Node
+	b.ForEachNode(func(n *Node) { nodes = append(nodes, n) })
+	if !st.LatencyScoreEnabled {
+		for _, n := range nodes {
+			n.setLatencyScore(100)
+		}
+		return
+	}
+
+	value := func(n *Node) float64 {
+		if st.LatencyMetric == "total" {
+			return n.LatencyEWMA()
+		}
+		return n.TTFBEWMA()
+	}
+	samples := make([]float64, 0, len(nodes))
+	for _, n := range nodes {
+		if atomic.LoadUint32(&n.latencySamples) >= uint32(st.LatencyMinSamples) {
+			samples = append(samples, value(n))
+		}
+	}
+	if len(samples) < 2 {
+		for _, n := range nodes {
+			n.setLatencyScore(100)
+		}
+		return
+	}
+	sort.Float64s(samples)
+	median := samples[len(samples)/2]
+	if len(samples)%2 == 0 {
+		median = (samples[len(samples)/2-1] + samples[len(samples)/2]) / 2
+	}
+	if median <= 0 {
+		for _, n := range nodes {
+			n.setLatencyScore(100)
+		}
+		return
+	}
+	for _, n := range nodes {
+		if atomic.LoadUint32(&n.latencySamples) < uint32(st.LatencyMinSamples) {
+			n.setLatencyScore(100)
+			continue
+		}
+		ratio := value(n) / median
+		score := 100.0
+		if ratio > st.LatencyTolerance {
+			score = clampFloat(100-st.LatencySlope*(ratio-st.LatencyTolerance), st.LatencyMinScore, 100)
+		}
+		n.setLatencyScore(int32(score))
+	}
+}
+
+func (n *Node) setLatencyScore(score int32) {
+	if atomic.SwapInt32(&n.latencyScore, score) != score {
+		n.SyncWeight(n.PassiveScore(), n.ActiveScore(), n.ConnDelta())
+	}
+}
@@ -0,0 +1,185 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var logger atomic.Pointer[slog.Logger]
+
+func init() {
+	logger.Store(slog.New(newTextHandler(os.Stdout, isTerminal(os.Stdout))))
+}
+
+// SetLogFormat switches the log output between "text" (the default
+// `[LEVEL] (time) msg key=value` lines) and "json" (one object per line).
+func SetLogFormat(format string) error {
+	switch strings.ToLower(strings.TrimSpace(format)) {
+	case "", "text":
+		logger.Store(slog.New(newTextHandler(os.Stdout, isTerminal(os.Stdout))))
+	case "json":
+		logger.Store(slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	default:
+		return fmt.Errorf("unknown log format %q", format)
+	}
+	return nil
+}
+
+func SetLogFormatFromEnv() {
+	if format := os.Getenv("KRYPTON_LOG_FORMAT"); format != "" {
+		if err := SetLogFormat(format); err != nil {
+			Warn("ignoring KRYPTON_LOG_FORMAT", "err", err)
+		}
+	}
+}
+
+func isTerminal(f *os.File) bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
+
+// textHandler renders records in the original Krypton line format. Level
+// filtering is done by the Debug/Info/Warn/Error helpers, not here.
+type textHandler struct {
+	mu    *sync.Mutex
+	w     io.Writer
+	color bool
+	attrs []slog.Attr
+	group string
+}
+
+func newTextHandler(w io.Writer, color bool) *textHandler {
+	return &textHandler{mu: &sync.Mutex{}, w: w, color: color}
+}
+
+func (h *textHandler) Enabled(context.Context, slog.Level) bool {
+	return true
+}
+
+func (h *textHandler) Handle(_ context.Context, r slog.Record) error {
+	var b strings.Builder
+	label, color := levelLabel(r.Level)
+	if h.color {
+		b.WriteString(color)
+	}
+	b.WriteString("[" + label + "]")
+	if h.color {
+		b.WriteString(colorReset)
+	}
+	b.WriteString(" (" + r.Time.Format("2006-01-02 15:04:05") + ") ")
+	b.WriteString(r.Message)
+	for _, a := range h.attrs {
+		writeTextAttr(&b, "", a)
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		writeTextAttr(&b, h.group, a)
+		return true
+	})
+	b.WriteByte('\n')
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := io.WriteString(h.w, b.String())
+	return err
+}
+
+func (h *textHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	next := *h
+	next.attrs = append(append([]slog.Attr(nil), h.attrs...), prefixAttrs(h.group, attrs)...)
+	return &next
+}
+
+func (h *textHandler) WithGroup(name string) slog.Handler {
+	next := *h
+	if next.group != "" {
+		next.group += "." + name
+	} else {
+		next.group = name
+	}
+	return &next
+}
+
+func prefixAttrs(group string, attrs []slog.Attr) []slog.Attr {
+	if group == "" {
+		return attrs
+	}
+	out := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		out[i] = slog.Attr{Key: group + "." + a.Key, Value: a.Value}
+	}
+	return out
+}
+
+func writeTextAttr(b *strings.Builder, group string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+	key := a.Key
+	if group != "" {
+		key = group + "." + key
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		for _, ga := range a.Value.Group() {
+			writeTextAttr(b, key, ga)
+		}
+		return
+	}
+	b.WriteByte(' ')
+	b.WriteString(key)
+	b.WriteByte('=')
+	b.WriteString(textValue(a.Value))
+}
+
+func textValue(v slog.Value) string {
+	var s string
+	switch v.Kind() {
+	case slog.KindString:
+		s = v.String()
+	case slog.KindDuration:
+		s = v.Duration().String()
+	case slog.KindTime:
+		s = v.Time().Format(time.RFC3339)
+	default:
+		s = fmt.Sprint(v.Any())
+	}
+	if s == "" || strings.ContainsAny(s, " \t\n\"=") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+func levelLabel(level slog.Level) (string, string) {
+	switch {
+	case level < slog.LevelInfo:
+		return "DEBUG", colorCyan
+	case level < slog.LevelWarn:
+		return "INFO", colorGreen
+	case level < slog.LevelError:
+		return "WARN", colorYellow
+	default:
+		return "ERROR", colorRed
+	}
+}
+
+const (
+	colorReset  = "\x1b[0m"
+	colorRed    = "\x1b[31m"
+	colorGreen  = "\x1b[32m"
+	colorYellow = "\x1b[33m"
+	colorCyan   = "\x1b[36m"
+)
@@ -1,7 +1,9 @@
 package gateway
 
 import (
+	"context"
 	"fmt"
+	"log/slog"
 	"os"
 	"strings"
 	"sync/atomic"
@@ -19,53 +21,267 @@ const (
 
 var logLevel int32 = int32(LevelInfo)
 
-func SetLogLevel(level LogLevel) {
-	atomic.StoreInt32(&logLevel, int32(level))
+func (l LogLevel) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	default:
+		return "unknown"
+	}
 }
 
-func SetLogLevelFromEnv() {
-	v := strings.ToLower(strings.TrimSpace(os.Getenv("KRYPTON_LOG_LEVEL")))
-	switch v {
+func ParseLogLevel(s string) (LogLevel, bool) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
 	case "debug":
-		SetLogLevel(LevelDebug)
+		return LevelDebug, true
 	case "info":
-		SetLogLevel(LevelInfo)
+		return LevelInfo, true
 	case "warn", "warning":
-		SetLogLevel(LevelWarn)
+		return LevelWarn, true
 	case "error":
-		SetLogLevel(LevelError)
+		return LevelError, true
+	default:
+		return LevelInfo, false
+	}
+}
+
+func SetLogLevel(level LogLevel) {
+	atomic.StoreInt32(&logLevel, int32(level))
+}
+
+func GetLogLevel() LogLevel {
+	return LogLevel(atomic.LoadInt32(&logLevel))
+}
+
+func SetLogLevelFromEnv() {
+	if level, ok := ParseLogLevel(os.Getenv("KRYPTON_LOG_LEVEL")); ok {
+		SetLogLevel(level)
+	}
+}
+
+// ShiftLogLevel moves the global level by delta steps, clamped to
+// debug..error. A negative delta makes logging more verbose.
+func ShiftLogLevel(delta int) LogLevel {
+	for {
+		old := atomic.LoadInt32(&logLevel)
+		next := old + int32(delta)
+		if next < int32(LevelDebug) {
+			next = int32(LevelDebug)
+		}
+		if next > int32(LevelError) {
+			next = int32(LevelError)
+		}
+		if atomic.CompareAndSwapInt32(&logLevel, old, next) {
+			return LogLevel(next)
+		}
+	}
+}
+
+// DebugScope turns on DEBUG output for one node id or request path prefix
+// until it expires, without changing the global level.
+type DebugScope struct {
+	Node    string    `json:"node,omitempty"`
+	Path    string    `json:"path,omitempty"`
+	Expires time.Time `json:"expires"`
+}
+
+// debugScopeSet is replaced as a whole; until is the latest expiry, so the
+// request path can tell whether any scope is live without walking the list.
+type debugScopeSet struct {
+	scopes []DebugScope
+	until  time.Time
+}
+
+var debugScopes atomic.Pointer[debugScopeSet]
+
+func newDebugScopeSet(scopes []DebugScope) *debugScopeSet {
+	if len(scopes) == 0 {
+		return nil
+	}
+	set := &debugScopeSet{scopes: scopes}
+	for _, s := range scopes {
+		if s.Expires.After(set.until) {
+			set.until = s.Expires
+		}
+	}
+	return set
+}
+
+func AddDebugScope(scope DebugScope) {
+	for {
+		old := debugScopes.Load()
+		next := newDebugScopeSet(append(activeDebugScopes(old, time.Now()), scope))
+		if debugScopes.CompareAndSwap(old, next) {
+			return
+		}
+	}
+}
+
+func ClearDebugScopes() {
+	debugScopes.Store(nil)
+}
+
+func DebugScopes() []DebugScope {
+	return pruneDebugScopes(time.Now())
+}
+
+// pruneDebugScopes drops expired scopes from the stored set and returns the
+// ones still active.
+func pruneDebugScopes(now time.Time) []DebugScope {
+	for {
+		old := debugScopes.Load()
+		active := activeDebugScopes(old, now)
+		if old == nil || len(active) == len(old.scopes) {
+			return active
+		}
+		if debugScopes.CompareAndSwap(old, newDebugScopeSet(active)) {
+			return active
+		}
+	}
+}
+
+func activeDebugScopes(set *debugScopeSet, now time.Time) []DebugScope {
+	out := make([]DebugScope, 0)
+	if set == nil {
+		return out
+	}
+	for _, s := range set.scopes {
+		if now.Before(s.Expires) {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// debugEnabled reports whether DEBUG output is on for a request to path
+// served by node, either globally or through a debug scope.
+func debugEnabled(node, path string) bool {
+	if GetLogLevel() <= LevelDebug {
+		return true
+	}
+	set := debugScopes.Load()
+	if set == nil {
+		return false
 	}
+	now := time.Now()
+	if !now.Before(set.until) {
+		pruneDebugScopes(now)
+		return false
+	}
+	for _, s := range set.scopes {
+		if !now.Before(s.Expires) {
+			continue
+		}
+		if s.Node != "" && s.Node != node {
+			continue
+		}
+		if s.Path != "" && !strings.HasPrefix(path, s.Path) {
+			continue
+		}
+		if s.Node == "" && s.Path == "" {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// debugPossible reports whether any DEBUG output can happen at all, for
+// callers that need to decide before the node is known. It runs on every
+// request, so it only checks the latest expiry and prunes once all scopes
+// have expired.
+func debugPossible() bool {
+	if GetLogLevel() <= LevelDebug {
+		return true
+	}
+	set := debugScopes.Load()
+	if set == nil {
+		return false
+	}
+	now := time.Now()
+	if now.Before(set.until) {
+		return true
+	}
+	pruneDebugScopes(now)
+	return false
+}
+
+// Debug logs at DEBUG. Records carrying a "node" or "path" attribute are
+// also written when a matching debug scope is active.
+func Debug(msg string, args ...any) {
+	if GetLogLevel() > LevelDebug && !debugEnabled(stringAttr(args, "node"), stringAttr(args, "path")) {
+		return
+	}
+	logger.Load().Log(context.Background(), slog.LevelDebug, msg, args...)
+}
+
+func Info(msg string, args ...any) {
+	logAt(LevelInfo, msg, args...)
+}
+
+func Warn(msg string, args ...any) {
+	logAt(LevelWarn, msg, args...)
+}
+
+func Error(msg string, args ...any) {
+	logAt(LevelError, msg, args...)
 }
 
 func Debugf(format string, args ...interface{}) {
-	logf(LevelDebug, "DEBUG", colorCyan, format, args...)
+	logAt(LevelDebug, fmt.Sprintf(format, args...))
 }
 
 func Infof(format string, args ...interface{}) {
-	logf(LevelInfo, "INFO", colorGreen, format, args...)
+	logAt(LevelInfo, fmt.Sprintf(format, args...))
 }
 
 func Warnf(format string, args ...interface{}) {
-	logf(LevelWarn, "WARN", colorYellow, format, args...)
+	logAt(LevelWarn, fmt.Sprintf(format, args...))
 }
 
 func Errorf(format string, args ...interface{}) {
-	logf(LevelError, "ERROR", colorRed, format, args...)
+	logAt(LevelError, fmt.Sprintf(format, args...))
 }
 
-func logf(level LogLevel, label string, color string, format string, args ...interface{}) {
-	if level < LogLevel(atomic.LoadInt32(&logLevel)) {
+func logAt(level LogLevel, msg string, args ...any) {
+	if level < GetLogLevel() {
 		return
 	}
-	ts := time.Now().Format("2006-01-02 15:04:05")
-	msg := fmt.Sprintf(format, args...)
-	fmt.Printf("%s[%s]%s (%s) %s\n", color, label, colorReset, ts, msg)
+	logger.Load().Log(context.Background(), slogLevel(level), msg, args...)
 }
 
-const (
-	colorReset  = "\x1b[0m"
-	colorRed    = "\x1b[31m"
-	colorGreen  = "\x1b[32m"
-	colorYellow = "\x1b[33m"
-	colorCyan   = "\x1b[36m"
-)
+// logAlways writes an INFO record regardless of the current level, for
+// notices about the level itself.
+func logAlways(msg string, args ...any) {
+	logger.Load().Log(context.Background(), slog.LevelInfo, msg, args...)
+}
+
+func slogLevel(level LogLevel) slog.Level {
+	switch level {
+	case LevelDebug:
+		return slog.LevelDebug
+	case LevelWarn:
+		return slog.LevelWarn
+	case LevelError:
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+func stringAttr(args []any, key string) string {
+	for i := 0; i+1 < len(args); i += 2 {
+		if k, ok := args[i].(string); ok && k == key {
+			if v, ok := args[i+1].(string); ok {
+				return v
+			}
+		}
+	}
+	return ""
+}
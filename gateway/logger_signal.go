@@ -0,0 +1,26 @@
+//go:build !windows
+
+package gateway
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// WatchLogSignals makes SIGUSR1 raise log verbosity one step (towards
+// DEBUG) and SIGUSR2 lower it (towards ERROR).
+func WatchLogSignals() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGUSR1, syscall.SIGUSR2)
+	go func() {
+		for sig := range ch {
+			delta := 1
+			if sig == syscall.SIGUSR1 {
+				delta = -1
+			}
+			level := ShiftLogLevel(delta)
+			logAlways("log level changed", "level", level.String(), "signal", sig.String())
+		}
+	}()
+}
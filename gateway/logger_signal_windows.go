@@ -0,0 +1,6 @@
+//go:build windows
+
+package gateway
+
+// WatchLogSignals is a no-op on Windows, which has no SIGUSR1/SIGUSR2.
+func WatchLogSignals() {}
@@ -0,0 +1,233 @@
+package gateway
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// metrics holds the counters and histograms exported on /metrics. Node
+// gauges are not stored here; they are read from Status at scrape time.
+type metrics struct {
+	requests      *counterVec
+	retries       *counterVec
+	triggers      *counterVec
+	healthChecks  *counterVec
+	upstream      *histogramVec
+	healthLatency *histogramVec
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		requests:      newCounterVec("krypton_requests_total", "Client requests by final upstream node, status and method.", "node", "status", "method"),
+		retries:       newCounterVec("krypton_retries_total", "Retries by node and reason.", "node", "reason"),
+		triggers:      newCounterVec("krypton_trigger_results_total", "Trigger script outcomes by node.", "node", "outcome"),
+		healthChecks:  newCounterVec("krypton_health_checks_total", "Health check runs by node and status.", "node", "status"),
+		upstream:      newHistogramVec("krypton_upstream_latency_seconds", "Upstream attempt latency by node.", latencyBuckets, "node"),
+		healthLatency: newHistogramVec("krypton_health_check_duration_seconds", "Health check script duration by node.", latencyBuckets, "node"),
+	}
+}
+
+func (m *metrics) observeRequest(node, method string, status int) {
+	if node == "" {
+		node = "none"
+	}
+	m.requests.inc(node, strconv.Itoa(status), metricMethod(method))
+}
+
+func metricMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodOptions, http.MethodConnect, http.MethodTrace:
+		return method
+	default:
+		return "OTHER"
+	}
+}
+
+func (m *metrics) write(w io.Writer, status BalancerStatus) {
+	m.requests.write(w)
+	m.retries.write(w)
+	m.triggers.write(w)
+	m.healthChecks.write(w)
+	m.upstream.write(w)
+	m.healthLatency.write(w)
+
+	gauges := []struct {
+		name, help string
+		value      func(NodeStatus) float64
+	}{
+		{"krypton_node_initial_weight", "Configured node weight.", func(n NodeStatus) float64 { return float64(n.InitialWeight) }},
+		{"krypton_node_effective_weight", "Current effective node weight.", func(n NodeStatus) float64 { return float64(n.EffectiveWeight) }},
+		{"krypton_node_passive_score", "Passive (traffic) score, 0-100.", func(n NodeStatus) float64 { return n.PassiveScore }},
+		{"krypton_node_active_score", "Active (health check) score, 0-100.", func(n NodeStatus) float64 { return n.ActiveScore }},
+		{"krypton_node_latency_score", "Latency score against the pool median, 0-100.", func(n NodeStatus) float64 { return n.LatencyScore }},
+		{"krypton_node_latency_ewma_seconds", "Smoothed upstream latency.", func(n NodeStatus) float64 { return n.LatencyMs / 1000 }},
+		{"krypton_node_ttfb_ewma_seconds", "Smoothed upstream time to first byte.", func(n NodeStatus) float64 { return n.TTFBMs / 1000 }},
+		{"krypton_node_inflight", "In-flight requests.", func(n NodeStatus) float64 { return float64(n.Inflight) }},
+		{"krypton_health_check_score", "Score returned by the last health check.", nil},
+	}
+	for _, g := range gauges {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", g.name, g.help, g.name)
+		for _, n := range status.Nodes {
+			if g.value == nil {
+				if n.LastHealth != nil {
+					fmt.Fprintf(w, "%s{node=\"%s\"} %d\n", g.name, escapeLabel(n.ID), n.LastHealth.Score)
+				}
+				continue
+			}
+			fmt.Fprintf(w, "%s{node=\"%s\"} %s\n", g.name, escapeLabel(n.ID), formatFloat(g.value(n)))
+		}
+	}
+	fmt.Fprintf(w, "# HELP krypton_node_state Node state, 1 for the current state.\n# TYPE krypton_node_state gauge\n")
+	for _, n := range status.Nodes {
+		for _, s := range []NodeState{NodeEnabled, NodeDraining, NodeDisabled} {
+			v := 0
+			if n.State == s.String() {
+				v = 1
+			}
+			fmt.Fprintf(w, "krypton_node_state{node=\"%s\",state=\"%s\"} %d\n", escapeLabel(n.ID), s, v)
+		}
+	}
+}
+
+func (h *AdminHandler) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	h.balancer.metrics.write(w, h.balancer.Status())
+}
+
+type counterVec struct {
+	name   string
+	help   string
+	labels []string
+	mu     sync.Mutex
+	values map[string]*counterValue
+}
+
+type counterValue struct {
+	labels []string
+	value  float64
+}
+
+func newCounterVec(name, help string, labels ...string) *counterVec {
+	return &counterVec{name: name, help: help, labels: labels, values: make(map[string]*counterValue)}
+}
+
+func (c *counterVec) inc(values ...string) {
+	key := strings.Join(values, "\xff")
+	c.mu.Lock()
+	v, ok := c.values[key]
+	if !ok {
+		v = &counterValue{labels: values}
+		c.values[key] = v
+	}
+	v.value++
+	c.mu.Unlock()
+}
+
+func (c *counterVec) write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, key := range sortedKeys(c.values) {
+		v := c.values[key]
+		fmt.Fprintf(w, "%s{%s} %s\n", c.name, formatLabels(c.labels, v.labels), formatFloat(v.value))
+	}
+}
+
+type histogramVec struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+	mu      sync.Mutex
+	values  map[string]*histogramValue
+}
+
+type histogramValue struct {
+	labels []string
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+func newHistogramVec(name, help string, buckets []float64, labels ...string) *histogramVec {
+	return &histogramVec{name: name, help: help, labels: labels, buckets: buckets, values: make(map[string]*histogramValue)}
+}
+
+func (hv *histogramVec) observe(d time.Duration, values ...string) {
+	sec := d.Seconds()
+	key := strings.Join(values, "\xff")
+	hv.mu.Lock()
+	v, ok := hv.values[key]
+	if !ok {
+		v = &histogramValue{labels: values, counts: make([]uint64, len(hv.buckets))}
+		hv.values[key] = v
+	}
+	for i, le := range hv.buckets {
+		if sec <= le {
+			v.counts[i]++
+		}
+	}
+	v.count++
+	v.sum += sec
+	hv.mu.Unlock()
+}
+
+func (hv *histogramVec) write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", hv.name, hv.help, hv.name)
+	hv.mu.Lock()
+	defer hv.mu.Unlock()
+	for _, key := range sortedKeys(hv.values) {
+		v := hv.values[key]
+		labels := formatLabels(hv.labels, v.labels)
+		for i, le := range hv.buckets {
+			fmt.Fprintf(w, "%s_bucket{%s,le=\"%s\"} %d\n", hv.name, labels, formatFloat(le), v.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket{%s,le=\"+Inf\"} %d\n", hv.name, labels, v.count)
+		fmt.Fprintf(w, "%s_sum{%s} %s\n", hv.name, labels, formatFloat(v.sum))
+		fmt.Fprintf(w, "%s_count{%s} %d\n", hv.name, labels, v.count)
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func formatLabels(names, values []string) string {
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = name + "=\"" + escapeLabel(values[i]) + "\""
+	}
+	return strings.Join(parts, ",")
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+func formatFloat(f float64) string {
+	if math.IsInf(f, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,47 @@
+package gateway
+
+import (
+	"time"
+)
+
+// ScoreOverride pins some of a node's scores until Expires. Nil fields are
+// left to the normal passive/active scoring.
+type ScoreOverride struct {
+	PassiveScore    *int32    `json:"passive_score,omitempty"`
+	ActiveScore     *int32    `json:"active_score,omitempty"`
+	EffectiveWeight *int32    `json:"effective_weight,omitempty"`
+	Expires         time.Time `json:"expires"`
+}
+
+func (n *Node) Override() *ScoreOverride {
+	o := n.override.Load()
+	if o == nil || !time.Now().Before(o.Expires) {
+		return nil
+	}
+	return o
+}
+
+// SetOverride installs o and re-syncs the weight. The override clears itself
+// when it expires, after which normal SyncWeight behaviour resumes.
+func (n *Node) SetOverride(o *ScoreOverride) {
+	ttl := time.Until(o.Expires)
+	if ttl <= 0 {
+		return
+	}
+	n.override.Store(o)
+	n.SyncWeight(n.PassiveScore(), n.ActiveScore(), n.ConnDelta())
+	time.AfterFunc(ttl, func() {
+		if n.override.CompareAndSwap(o, nil) {
+			n.SyncWeight(n.PassiveScore(), n.ActiveScore(), n.ConnDelta())
+			Info("override expired", "node", n.ID)
+		}
+	})
+}
+
+func (n *Node) ClearOverride() bool {
+	if n.override.Swap(nil) == nil {
+		return false
+	}
+	n.SyncWeight(n.PassiveScore(), n.ActiveScore(), n.ConnDelta())
+	return true
+}
@@ -10,6 +10,7 @@ import (
 	"net/http"
 	"net/http/httputil"
 	"net/url"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -38,6 +39,7 @@ func NewNode(nc NodeConfig) (*Node, error) {
 		effectiveWeight: nc.Weight,
 		passiveScore:    100,
 		activeScore:     100,
+		latencyScore:    100,
 		checkScript:     nc.CheckScript,
 	}
 	return n, nil
@@ -67,16 +69,31 @@ func SetupRetryableBody(r *http.Request, maxBodySize int64) error {
 }
 
 func (b *Balancer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	acc := &accessEntry{Start: time.Now()}
+	if b.access != nil {
+		aw := &accessWriter{ResponseWriter: w}
+		w = aw
+		defer func() { b.access.write(r, aw, acc) }()
+	}
 	if err := SetupRetryableBody(r, b.config.Gateway.MaxBodySize); err != nil {
 		http.Error(w, "invalid body", http.StatusBadRequest)
 		return
 	}
 
 	reqID := ensureRequestID(r)
-	start := time.Now()
+	acc.RequestID = reqID
+	capture := b.startCapture(r, reqID)
+	defer capture.write()
+	start := acc.Start
+	ctx, span := startServerSpan(r, "krypton.request")
+	defer span.End()
+	span.SetAttr("http.request.method", r.Method)
+	span.SetAttr("url.path", r.URL.Path)
+	span.SetAttr("krypton.request_id", reqID)
+	r = r.WithContext(ctx)
 	var rw http.ResponseWriter = w
 	var recorder *responseRecorder
-	if LogLevel(atomic.LoadInt32(&logLevel)) == LevelDebug || b.config.Gateway.TriggerScript != "" {
+	if debugPossible() || b.config.Gateway.TriggerScript != "" {
 		limit := 4096
 		if b.config.Gateway.TriggerBodyLimit > 0 {
 			limit = b.config.Gateway.TriggerBodyLimit
@@ -97,18 +114,31 @@ func (b *Balancer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		maxRetries = 0
 	}
 
-	key := r.RemoteAddr
+	key, sticky := b.requestKey(r)
 	var lastErr error
 	lastNodeID := ""
 	lastRetryReason := ""
 	for i := 0; i <= maxRetries; i++ {
-		node := b.Select(key)
+		var node *Node
+		if sticky && i == 0 {
+			node = b.selectAffinity(key)
+		}
+		if node == nil {
+			node = b.Select(key)
+		}
 		if node == nil {
-			Warnf("upstream none request_id=%s method=%s path=%s", reqID, r.Method, r.URL.Path)
+			Warn("upstream none", "request_id", reqID, "method", r.Method, "path", r.URL.Path)
+			b.metrics.observeRequest(lastNodeID, r.Method, http.StatusServiceUnavailable)
+			span.SetAttr("http.response.status_code", http.StatusServiceUnavailable)
+			span.SetError(errors.New("no upstream available"))
+			b.setAttribution(w.Header(), lastNodeID, i, lastRetryReason, start, acc.Upstream)
 			http.Error(w, "no upstream available", http.StatusServiceUnavailable)
 			return
 		}
 		lastNodeID = node.ID
+		acc.Node = node.ID
+		acc.Attempts = i + 1
+		Debug("upstream attempt", "request_id", reqID, "node", node.ID, "attempt", i+1, "method", r.Method, "path", r.URL.Path)
 
 		req := r.Clone(r.Context())
 		if r.GetBody != nil {
@@ -123,9 +153,18 @@ func (b *Balancer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			break
 		}
 
+		attemptCtx, attemptSpan := startSpan(r.Context(), "krypton.upstream_attempt", spanKindClient)
+		attemptSpan.SetAttr("krypton.node.id", node.ID)
+		attemptSpan.SetAttr("krypton.attempt", i+1)
+		attemptSpan.SetAttr("server.address", node.targetURL.Host)
+		req = req.WithContext(attemptCtx)
+		captured := capture.attempt(req, node, i+1)
+
 		var failed int32
 		var stopRetry int32
 		var respStatus int32
+		var attemptStart time.Time
+		var ttfb time.Duration
 		attempt := i + 1
 		total := maxRetries + 1
 		canRetry := attempt < total
@@ -138,25 +177,36 @@ func (b *Balancer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			req.Host = target.Host
 			req.Header = r.Header.Clone()
 			req.Header.Set("X-Request-Id", reqID)
+			injectTraceContext(attemptSpan, req.Header)
 			if req.Header.Get("User-Agent") == "" {
 				req.Header.Set("User-Agent", "krypton")
 			}
 		}
 		proxy.ErrorHandler = func(_ http.ResponseWriter, _ *http.Request, err error) {
 			atomic.StoreInt32(&failed, 1)
+			captured.fail(err)
 			lastErr = err
+			// The trigger has already recorded the retry and adjusted the
+			// node's score.
+			var te triggerRetryError
+			if errors.As(err, &te) {
+				return
+			}
 			if canRetry && shouldRetryError(err, retryCfg) {
 				lastRetryReason = retryReason(err)
-				Warnf("upstream error request_id=%s node=%s method=%s path=%s err=%v", reqID, node.ID, r.Method, r.URL.Path, err)
-				Infof("retry request_id=%s node=%s attempt=%d/%d reason=%s", reqID, node.ID, attempt, total, lastRetryReason)
+				Warn("upstream error", "request_id", reqID, "node", node.ID, "attempt", attempt, "method", r.Method, "path", r.URL.Path, "err", err)
+				b.noteRetry(r, reqID, node, attempt, total, lastRetryReason)
 			} else {
 				lastRetryReason = retryReason(err)
 				atomic.StoreInt32(&stopRetry, 1)
 			}
-			b.handleError(node, err)
+			b.handleError(node.current(), err)
 		}
 		proxy.ModifyResponse = func(resp *http.Response) error {
 			atomic.StoreInt32(&respStatus, int32(resp.StatusCode))
+			ttfb = time.Since(attemptStart)
+			captured.response(resp)
+			b.setAttribution(resp.Header, node.ID, attempt, lastRetryReason, start, acc.Upstream+time.Since(attemptStart))
 			var bodyBytes []byte
 			if b.config.Gateway.TriggerScript != "" || recorder != nil {
 				limit := 4096
@@ -174,38 +224,59 @@ func (b *Balancer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			}
 
 			if b.config.Gateway.TriggerScript != "" && len(bodyBytes) > 0 {
-				triggerRetry := b.runTriggerOnResponse(r, resp.StatusCode, bodyBytes, node)
+				triggerRetry := b.runTriggerOnResponse(resp.Request.Context(), r, resp.StatusCode, bodyBytes, node.current())
 				if triggerRetry && retryCfg.Enabled && canRetry {
 					lastRetryReason = "trigger"
-					Infof("retry request_id=%s node=%s attempt=%d/%d reason=%s", reqID, node.ID, attempt, total, lastRetryReason)
-					return upstreamStatusError{StatusCode: resp.StatusCode}
+					b.noteRetry(r, reqID, node, attempt, total, lastRetryReason)
+					return triggerRetryError{StatusCode: resp.StatusCode}
 				}
 			}
 
-			if retryCfg.Enabled && retryCfg.RetryOn5xx && canRetry && resp.StatusCode >= 500 && resp.StatusCode < 600 {
-				lastRetryReason = "5xx"
-				Infof("retry request_id=%s node=%s attempt=%d/%d reason=%s", reqID, node.ID, attempt, total, lastRetryReason)
-				return upstreamStatusError{StatusCode: resp.StatusCode}
-			}
 			return nil
 		}
-		proxy.Transport = &retryTransport{base: baseTransport(node.Proxy), retry: retryCfg}
+		proxy.Transport = &retryTransport{base: baseTransport(node.Proxy), retry: retryCfg, capture: captured}
 
 		b.adjustConn(node, 1)
+		attemptStart = time.Now()
 		proxy.ServeHTTP(rw, req)
+		b.metrics.upstream.observe(time.Since(attemptStart), node.ID)
+		acc.Upstream += time.Since(attemptStart)
+		captured.finish()
+		acc.RetryReason = lastRetryReason
 		b.adjustConn(node, -1)
+		if status := atomic.LoadInt32(&respStatus); status != 0 {
+			attemptSpan.SetAttr("http.response.status_code", int(status))
+		}
+		if atomic.LoadInt32(&failed) == 1 {
+			attemptSpan.SetError(lastErr)
+			if atomic.LoadInt32(&stopRetry) == 0 && canRetry {
+				attemptSpan.SetAttr("krypton.retry_reason", lastRetryReason)
+			}
+		}
+		attemptSpan.End()
 		if atomic.LoadInt32(&failed) == 0 {
+			// A reload during the attempt may have replaced the node; score
+			// the live one.
+			cur := node.current()
 			status := int(atomic.LoadInt32(&respStatus))
 			if status >= 500 && status < 600 {
 				if status == http.StatusInternalServerError || status == http.StatusNotImplemented {
-					node.UpdatePassiveScore(-5, b.config.Strategy.MaxPenaltyPerSecond)
-					node.SyncWeight(node.PassiveScore(), node.ActiveScore(), node.ConnDelta())
+					cur.UpdatePassiveScore(-5, b.config.Strategy.MaxPenaltyPerSecond)
+					cur.SyncWeight(cur.PassiveScore(), cur.ActiveScore(), cur.ConnDelta())
 				}
 			} else {
-				node.UpdatePassiveScore(5, b.config.Strategy.MaxPenaltyPerSecond)
-				node.SyncWeight(node.PassiveScore(), node.ActiveScore(), node.ConnDelta())
+				cur.observeLatency(time.Since(attemptStart), ttfb, b.config.Strategy.LatencyEWMAAlpha)
+				cur.UpdatePassiveScore(5, b.config.Strategy.MaxPenaltyPerSecond)
+				cur.SyncWeight(cur.PassiveScore(), cur.ActiveScore(), cur.ConnDelta())
+			}
+			b.logRequest(r, status, time.Since(start), recorder, reqID, node.ID)
+			b.metrics.observeRequest(node.ID, r.Method, status)
+			span.SetAttr("krypton.node.id", node.ID)
+			span.SetAttr("krypton.attempts", attempt)
+			span.SetAttr("http.response.status_code", status)
+			if status >= 500 {
+				span.SetError(fmt.Errorf("upstream status %d", status))
 			}
-			logRequest(r, status, time.Since(start), recorder, reqID, node.ID)
 			return
 		}
 		if atomic.LoadInt32(&stopRetry) == 1 {
@@ -214,12 +285,39 @@ func (b *Balancer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if lastErr != nil {
-		Warnf("upstream error request_id=%s node=%s method=%s path=%s err=%v retry_reason=%s", reqID, lastNodeID, r.Method, r.URL.Path, lastErr, lastRetryReason)
+		Warn("upstream error", "request_id", reqID, "node", lastNodeID, "method", r.Method, "path", r.URL.Path, "err", lastErr, "retry_reason", lastRetryReason)
+		b.setAttribution(w.Header(), lastNodeID, acc.Attempts, lastRetryReason, start, acc.Upstream)
 		http.Error(w, "upstream error", http.StatusBadGateway)
+		b.metrics.observeRequest(lastNodeID, r.Method, http.StatusBadGateway)
+		span.SetAttr("krypton.node.id", lastNodeID)
+		span.SetAttr("http.response.status_code", http.StatusBadGateway)
+		span.SetError(lastErr)
 		return
 	}
-	Warnf("upstream error request_id=%s node=%s method=%s path=%s err=%v retry_reason=%s", reqID, lastNodeID, r.Method, r.URL.Path, lastErr, lastRetryReason)
+	Warn("upstream error", "request_id", reqID, "node", lastNodeID, "method", r.Method, "path", r.URL.Path, "err", lastErr, "retry_reason", lastRetryReason)
+	b.setAttribution(w.Header(), lastNodeID, acc.Attempts, lastRetryReason, start, acc.Upstream)
 	http.Error(w, "upstream error", http.StatusBadGateway)
+	b.metrics.observeRequest(lastNodeID, r.Method, http.StatusBadGateway)
+	span.SetAttr("krypton.node.id", lastNodeID)
+	span.SetAttr("http.response.status_code", http.StatusBadGateway)
+	span.SetError(errors.New("upstream error"))
+}
+
+func (b *Balancer) noteRetry(r *http.Request, reqID string, node *Node, attempt, total int, reason string) {
+	Info("retry", "request_id", reqID, "node", node.ID, "attempt", attempt, "total", total, "reason", reason)
+	b.metrics.retries.inc(node.ID, reason)
+	b.events.publish(Event{
+		Type: eventRetry,
+		Node: node.ID,
+		Data: RetryEvent{
+			RequestID: reqID,
+			Attempt:   attempt,
+			Total:     total,
+			Reason:    reason,
+			Method:    r.Method,
+			Path:      r.URL.Path,
+		},
+	})
 }
 
 func shouldRetryError(err error, cfg RetryConfig) bool {
@@ -253,10 +351,14 @@ func retryReason(err error) string {
 	return "error"
 }
 
-func (b *Balancer) runTriggerOnResponse(r *http.Request, status int, body []byte, node *Node) bool {
+func (b *Balancer) runTriggerOnResponse(ctx context.Context, r *http.Request, status int, body []byte, node *Node) bool {
 	if b.config.Gateway.TriggerScript == "" {
 		return false
 	}
+	ctx, span := startSpan(ctx, "krypton.trigger", spanKindInternal)
+	defer span.End()
+	span.SetAttr("krypton.node.id", node.ID)
+	span.SetAttr("http.response.status_code", status)
 	req := &triggerRequest{
 		Method:  r.Method,
 		Path:    r.URL.Path,
@@ -266,12 +368,15 @@ func (b *Balancer) runTriggerOnResponse(r *http.Request, status int, body []byte
 		Status: status,
 		Body:   string(body),
 	}
-	result, err := runTrigger(r.Context(), b.config, node, req, resp)
+	result, err := runTrigger(ctx, b.config, node, req, resp)
 	if err != nil {
-		Warnf("trigger error request_id=%s node=%s err=%v", r.Header.Get("X-Request-Id"), node.ID, err)
+		span.SetError(err)
+		Warn("trigger error", "request_id", r.Header.Get("X-Request-Id"), "node", node.ID, "err", err)
+		b.metrics.triggers.inc(node.ID, "error")
 		return false
 	}
 	if result == nil {
+		b.metrics.triggers.inc(node.ID, "none")
 		return false
 	}
 	if result.Score != nil {
@@ -285,11 +390,14 @@ func (b *Balancer) runTriggerOnResponse(r *http.Request, status int, body []byte
 	}
 	node.SyncWeight(node.PassiveScore(), node.ActiveScore(), node.ConnDelta())
 	if result.Message != "" {
-		Infof("trigger applied request_id=%s node=%s msg=%s", r.Header.Get("X-Request-Id"), node.ID, result.Message)
+		Info("trigger applied", "request_id", r.Header.Get("X-Request-Id"), "node", node.ID, "msg", result.Message)
 	}
 	if result.Retry != nil && *result.Retry {
+		b.metrics.triggers.inc(node.ID, "retry")
+		span.SetAttr("krypton.trigger.retry", true)
 		return true
 	}
+	b.metrics.triggers.inc(node.ID, "applied")
 	return false
 }
 
@@ -405,6 +513,26 @@ func newResponseRecorder(w http.ResponseWriter, limit int) *responseRecorder {
 	}
 }
 
+// setAttribution tells the client which node answered, after how many
+// attempts, and how the time split between upstream and gateway.
+func (b *Balancer) setAttribution(h http.Header, nodeID string, attempts int, retryReason string, start time.Time, upstream time.Duration) {
+	if !b.config.Gateway.AttributionHeaders {
+		return
+	}
+	if nodeID != "" {
+		h.Set("X-Krypton-Node", nodeID)
+	}
+	h.Set("X-Krypton-Attempts", strconv.Itoa(attempts))
+	if retryReason != "" {
+		h.Set("X-Krypton-Retry-Reason", retryReason)
+	}
+	gateway := time.Since(start) - upstream
+	if gateway < 0 {
+		gateway = 0
+	}
+	h.Add("Server-Timing", fmt.Sprintf("upstream;dur=%.1f, gateway;dur=%.1f", float64(upstream.Microseconds())/1000, float64(gateway.Microseconds())/1000))
+}
+
 func (r *responseRecorder) WriteHeader(statusCode int) {
 	r.status = statusCode
 	r.wroteHeader = true
@@ -426,10 +554,15 @@ func (r *responseRecorder) Write(b []byte) (int, error) {
 	return r.ResponseWriter.Write(b)
 }
 
-func logRequest(r *http.Request, status int, dur time.Duration, rec *responseRecorder, reqID, nodeID string) {
-	Infof("request request_id=%s node=%s method=%s path=%s status=%d latency_ms=%d", reqID, nodeID, r.Method, r.URL.Path, status, dur.Milliseconds())
+func (b *Balancer) logRequest(r *http.Request, status int, dur time.Duration, rec *responseRecorder, reqID, nodeID string) {
+	log := Info
+	if b.access != nil {
+		// The access log already has this line; keep it out of the app log.
+		log = Debug
+	}
+	log("request", "request_id", reqID, "node", nodeID, "method", r.Method, "path", r.URL.Path, "status", status, "latency_ms", dur.Milliseconds())
 	if rec != nil && len(rec.body) > 0 {
-		Debugf("response request_id=%s body=%s", reqID, string(rec.body))
+		Debug("response", "request_id", reqID, "node", nodeID, "path", r.URL.Path, "body", string(rec.body))
 	}
 }
 
@@ -458,6 +591,15 @@ func (e upstreamStatusError) Error() string {
 	return "upstream status error"
 }
 
+// triggerRetryError aborts a response the trigger script asked to retry.
+type triggerRetryError struct {
+	StatusCode int
+}
+
+func (e triggerRetryError) Error() string {
+	return "trigger requested retry"
+}
+
 func isUpstreamRetryable(err error) bool {
 	var se upstreamStatusError
 	if errors.As(err, &se) {
@@ -467,8 +609,9 @@ func isUpstreamRetryable(err error) bool {
 }
 
 type retryTransport struct {
-	base  http.RoundTripper
-	retry RetryConfig
+	base    http.RoundTripper
+	retry   RetryConfig
+	capture *captureAttempt
 }
 
 func (t *retryTransport) RoundTrip(r *http.Request) (*http.Response, error) {
@@ -477,6 +620,7 @@ func (t *retryTransport) RoundTrip(r *http.Request) (*http.Response, error) {
 		return nil, err
 	}
 	if t.retry.Enabled && t.retry.RetryOn5xx && resp.StatusCode >= 500 && resp.StatusCode < 600 {
+		t.capture.drain(resp)
 		_ = resp.Body.Close()
 		return nil, upstreamStatusError{StatusCode: resp.StatusCode}
 	}
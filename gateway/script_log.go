@@ -0,0 +1,56 @@
+package gateway
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.starlark.net/starlark"
+)
+
+const scriptLogLocal = "krypton.script_log"
+
+type ScriptLogLine struct {
+	Time    time.Time `json:"time"`
+	Level   string    `json:"level"`
+	Message string    `json:"message"`
+}
+
+// scriptLog collects log.* output from a single script run so dry-run
+// endpoints can return it alongside the result.
+type scriptLog struct {
+	mu    sync.Mutex
+	lines []ScriptLogLine
+}
+
+func (l *scriptLog) add(level, msg string) {
+	l.mu.Lock()
+	l.lines = append(l.lines, ScriptLogLine{Time: time.Now(), Level: level, Message: msg})
+	l.mu.Unlock()
+}
+
+func (l *scriptLog) Lines() []ScriptLogLine {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]ScriptLogLine{}, l.lines...)
+}
+
+type scriptLogKey struct{}
+
+func withScriptLog(ctx context.Context, l *scriptLog) context.Context {
+	return context.WithValue(ctx, scriptLogKey{}, l)
+}
+
+// attachScriptLog makes the capture in ctx, if any, visible to the log
+// builtins running on thread.
+func attachScriptLog(ctx context.Context, thread *starlark.Thread) {
+	if l, ok := ctx.Value(scriptLogKey{}).(*scriptLog); ok {
+		thread.SetLocal(scriptLogLocal, l)
+	}
+}
+
+func captureScriptLog(thread *starlark.Thread, level, msg string) {
+	if l, ok := thread.Local(scriptLogLocal).(*scriptLog); ok {
+		l.add(level, msg)
+	}
+}
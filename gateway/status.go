@@ -0,0 +1,75 @@
+package gateway
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+type NodeStatus struct {
+	ID              string         `json:"id"`
+	Address         string         `json:"address"`
+	Bucket          int            `json:"bucket"`
+	State           string         `json:"state"`
+	InitialWeight   int32          `json:"initial_weight"`
+	EffectiveWeight int32          `json:"effective_weight"`
+	CurrentWeight   int32          `json:"current_weight"`
+	PassiveScore    float64        `json:"passive_score"`
+	ActiveScore     float64        `json:"active_score"`
+	ConnDelta       float64        `json:"conn_delta"`
+	LatencyScore    float64        `json:"latency_score"`
+	LatencyMs       float64        `json:"latency_ewma_ms"`
+	TTFBMs          float64        `json:"ttfb_ewma_ms"`
+	Inflight        int32          `json:"inflight"`
+	LastHealth      *HealthRecord  `json:"last_health,omitempty"`
+	Override        *ScoreOverride `json:"override,omitempty"`
+}
+
+type BalancerStatus struct {
+	Status        string       `json:"status"`
+	Time          time.Time    `json:"time"`
+	Shards        int          `json:"shards"`
+	NodeCount     int32        `json:"node_count"`
+	TotalInflight int64        `json:"total_inflight"`
+	TotalWeight   int64        `json:"total_effective_weight"`
+	Nodes         []NodeStatus `json:"nodes"`
+}
+
+// Status returns a point-in-time view of every node. Each bucket is locked
+// while it is read so currentWeight is consistent with the SWRR state.
+func (b *Balancer) Status() BalancerStatus {
+	st := BalancerStatus{
+		Status:        "ok",
+		Time:          time.Now(),
+		Shards:        len(b.buckets),
+		NodeCount:     atomic.LoadInt32(&b.nodeCount),
+		TotalInflight: atomic.LoadInt64(&b.totalInflight),
+		Nodes:         make([]NodeStatus, 0),
+	}
+	for idx, bucket := range b.buckets {
+		bucket.mu.Lock()
+		for _, n := range bucket.nodes {
+			ns := NodeStatus{
+				ID:              n.ID,
+				Address:         n.Address,
+				Bucket:          idx,
+				State:           n.State().String(),
+				InitialWeight:   n.InitialWeight,
+				EffectiveWeight: atomic.LoadInt32(&n.effectiveWeight),
+				CurrentWeight:   n.currentWeight,
+				PassiveScore:    n.PassiveScore(),
+				ActiveScore:     n.ActiveScore(),
+				ConnDelta:       n.ConnDelta(),
+				LatencyScore:    n.LatencyScore(),
+				LatencyMs:       n.LatencyEWMA(),
+				TTFBMs:          n.TTFBEWMA(),
+				Inflight:        atomic.LoadInt32(&n.inflight),
+				LastHealth:      n.lastHealth.Load(),
+				Override:        n.Override(),
+			}
+			st.TotalWeight += int64(ns.EffectiveWeight)
+			st.Nodes = append(st.Nodes, ns)
+		}
+		bucket.mu.Unlock()
+	}
+	return st
+}
@@ -0,0 +1,263 @@
+package gateway
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// Strategy picks one node out of a bucket's routable candidates. Pick is
+// called with the bucket lock held and candidates is only valid for the
+// call, so implementations may keep state without locking of their own.
+// Every strategy weighs nodes by their effective weight.
+type Strategy interface {
+	Pick(candidates []*Node, key string) *Node
+}
+
+var strategyNames = []string{"swrr", "least_conn", "p2c_ewma", "weighted_random", "ring_hash"}
+
+func newStrategy(name string) (Strategy, error) {
+	switch name {
+	case "", "swrr":
+		return swrrStrategy{}, nil
+	case "least_conn":
+		return &leastConnStrategy{}, nil
+	case "p2c_ewma":
+		return &p2cStrategy{rand: newStrategyRand()}, nil
+	case "weighted_random":
+		return &weightedRandomStrategy{rand: newStrategyRand()}, nil
+	case "ring_hash":
+		return &ringHashStrategy{}, nil
+	default:
+		return nil, fmt.Errorf("unknown strategy %q", name)
+	}
+}
+
+// checkRingHash rejects ring_hash over several shards without hash_shard:
+// each shard keeps its own ring, so a randomly chosen shard would break the
+// key to node mapping.
+func checkRingHash(st StrategyConfig, shards int) error {
+	if st.Algorithm == "ring_hash" && shards > 1 && !st.HashShard {
+		return errors.New("ring_hash with gateway.shards > 1 requires strategy.hash_shard = true")
+	}
+	return nil
+}
+
+func newStrategyRand() *rand.Rand {
+	return rand.New(rand.NewSource(time.Now().UnixNano()))
+}
+
+// swrrStrategy is smooth weighted round-robin over Node.currentWeight.
+type swrrStrategy struct{}
+
+func (swrrStrategy) Pick(candidates []*Node, _ string) *Node {
+	var total int32
+	var best *Node
+	for _, n := range candidates {
+		ew := atomic.LoadInt32(&n.effectiveWeight)
+		n.currentWeight += ew
+		total += ew
+		if best == nil || n.currentWeight > best.currentWeight {
+			best = n
+		}
+	}
+	if best != nil {
+		best.currentWeight -= total
+	}
+	return best
+}
+
+// leastConnStrategy picks the node with the fewest in-flight requests per
+// unit of effective weight. The scan starts one node further each call so
+// ties rotate instead of always going to the first node.
+type leastConnStrategy struct {
+	next int
+}
+
+func (s *leastConnStrategy) Pick(candidates []*Node, _ string) *Node {
+	var best *Node
+	var bestLoad float64
+	s.next++
+	for i := range candidates {
+		n := candidates[(s.next+i)%len(candidates)]
+		ew := atomic.LoadInt32(&n.effectiveWeight)
+		if ew <= 0 {
+			continue
+		}
+		load := float64(atomic.LoadInt32(&n.inflight)+1) / float64(ew)
+		if best == nil || load < bestLoad {
+			best, bestLoad = n, load
+		}
+	}
+	if best == nil && len(candidates) > 0 {
+		return candidates[0]
+	}
+	return best
+}
+
+// p2cStrategy draws two nodes by effective weight and keeps the one with the
+// lower EWMA time to first byte times in-flight requests. TTFB is used rather
+// than total latency so long streamed responses do not count against a node.
+type p2cStrategy struct {
+	rand *rand.Rand
+}
+
+func (s *p2cStrategy) Pick(candidates []*Node, _ string) *Node {
+	a := pickWeighted(s.rand, candidates)
+	if len(candidates) < 2 {
+		return a
+	}
+	b := pickWeighted(s.rand, candidates)
+	for i := 0; b == a && i < 3; i++ {
+		b = pickWeighted(s.rand, candidates)
+	}
+	if p2cCost(b) < p2cCost(a) {
+		return b
+	}
+	return a
+}
+
+func p2cCost(n *Node) float64 {
+	return (n.TTFBEWMA() + 1) * float64(atomic.LoadInt32(&n.inflight)+1)
+}
+
+type weightedRandomStrategy struct {
+	rand *rand.Rand
+}
+
+func (s *weightedRandomStrategy) Pick(candidates []*Node, _ string) *Node {
+	return pickWeighted(s.rand, candidates)
+}
+
+// pickWeighted draws a node with probability proportional to its effective
+// weight, or uniformly when every weight is zero.
+func pickWeighted(r *rand.Rand, candidates []*Node) *Node {
+	if len(candidates) == 0 {
+		return nil
+	}
+	var total int64
+	for _, n := range candidates {
+		if ew := atomic.LoadInt32(&n.effectiveWeight); ew > 0 {
+			total += int64(ew)
+		}
+	}
+	if total == 0 {
+		return candidates[r.Intn(len(candidates))]
+	}
+	x := r.Int63n(total)
+	for _, n := range candidates {
+		if ew := atomic.LoadInt32(&n.effectiveWeight); ew > 0 {
+			x -= int64(ew)
+			if x < 0 {
+				return n
+			}
+		}
+	}
+	return candidates[len(candidates)-1]
+}
+
+const (
+	ringPointsMax = 160
+	ringLevels    = 16
+)
+
+// ringHashStrategy maps the key onto a consistent-hash ring. Each node gets
+// points in proportion to its effective weight, rounded to ringLevels steps
+// so the ring is only rebuilt when weights move noticeably.
+type ringHashStrategy struct {
+	sig    []ringSig
+	points []ringPoint
+}
+
+type ringSig struct {
+	node  *Node
+	level int
+}
+
+type ringPoint struct {
+	hash uint32
+	node *Node
+}
+
+func (s *ringHashStrategy) Pick(candidates []*Node, key string) *Node {
+	if len(candidates) == 0 {
+		return nil
+	}
+	s.rebuild(candidates)
+	if len(s.points) == 0 {
+		return nil
+	}
+	h := hashKey(key)
+	i := sort.Search(len(s.points), func(i int) bool { return s.points[i].hash >= h })
+	if i == len(s.points) {
+		i = 0
+	}
+	return s.points[i].node
+}
+
+// rebuild refreshes the ring when the candidates or their weight levels
+// differ from the cached signature. The check runs on every Pick, so it
+// compares in place and allocates only when the ring changes.
+func (s *ringHashStrategy) rebuild(candidates []*Node) {
+	var maxW int32
+	for _, n := range candidates {
+		if ew := atomic.LoadInt32(&n.effectiveWeight); ew > maxW {
+			maxW = ew
+		}
+	}
+	if s.sigMatches(candidates, maxW) {
+		return
+	}
+	s.sig = s.sig[:0]
+	for _, n := range candidates {
+		s.sig = append(s.sig, ringSig{node: n, level: ringLevel(n, maxW)})
+	}
+	s.points = s.points[:0]
+	for _, e := range s.sig {
+		count := e.level * ringPointsMax / ringLevels
+		for i := 0; i < count; i++ {
+			s.points = append(s.points, ringPoint{hash: hashKey(e.node.ID + "#" + strconv.Itoa(i)), node: e.node})
+		}
+	}
+	sort.Slice(s.points, func(i, j int) bool { return s.points[i].hash < s.points[j].hash })
+}
+
+func (s *ringHashStrategy) sigMatches(candidates []*Node, maxW int32) bool {
+	if len(s.sig) != len(candidates) {
+		return false
+	}
+	for i, n := range candidates {
+		if s.sig[i] != (ringSig{node: n, level: ringLevel(n, maxW)}) {
+			return false
+		}
+	}
+	return true
+}
+
+func ringLevel(n *Node, maxW int32) int {
+	if maxW <= 0 {
+		return 1
+	}
+	ew := atomic.LoadInt32(&n.effectiveWeight)
+	return int((int64(ew)*ringLevels + int64(maxW) - 1) / int64(maxW))
+}
+
+// hashKey is FNV-1a followed by the murmur3 finalizer; plain FNV clusters
+// short keys that differ only in their last bytes, which skews a ring.
+func hashKey(key string) uint32 {
+	x := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		x ^= uint32(key[i])
+		x *= 16777619
+	}
+	x ^= x >> 16
+	x *= 0x85ebca6b
+	x ^= x >> 13
+	x *= 0xc2b2ae35
+	x ^= x >> 16
+	return x
+}
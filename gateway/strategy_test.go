@@ -0,0 +1,155 @@
+package gateway
+
+import (
+	"fmt"
+	"math"
+	"sync/atomic"
+	"testing"
+)
+
+func testNodes(t *testing.T, weights ...int32) []*Node {
+	t.Helper()
+	nodes := make([]*Node, 0, len(weights))
+	for i, w := range weights {
+		n, err := NewNode(NodeConfig{ID: fmt.Sprintf("n%d", i), Address: fmt.Sprintf("http://127.0.0.1:%d", 9001+i), Weight: w})
+		if err != nil {
+			t.Fatalf("NewNode: %v", err)
+		}
+		nodes = append(nodes, n)
+	}
+	return nodes
+}
+
+func TestRingHashStable(t *testing.T) {
+	nodes := testNodes(t, 100, 100, 100, 100)
+	s, err := newStrategy("ring_hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _ := newStrategy("ring_hash")
+
+	used := make(map[*Node]bool)
+	for i := 0; i < 200; i++ {
+		key := fmt.Sprintf("user-%d", i)
+		first := s.Pick(nodes, key)
+		if first == nil {
+			t.Fatalf("%s: no node picked", key)
+		}
+		used[first] = true
+		for j := 0; j < 3; j++ {
+			if got := s.Pick(nodes, key); got != first {
+				t.Fatalf("%s: pick %d = %s, want %s", key, j, got.ID, first.ID)
+			}
+		}
+		if got := other.Pick(nodes, key); got != first {
+			t.Errorf("%s: separate ring picked %s, want %s", key, got.ID, first.ID)
+		}
+	}
+	if len(used) != len(nodes) {
+		t.Errorf("keys landed on %d of %d nodes", len(used), len(nodes))
+	}
+}
+
+func TestRingHashRemapsOnlyRemovedNode(t *testing.T) {
+	nodes := testNodes(t, 100, 100, 100, 100)
+	s, _ := newStrategy("ring_hash")
+	before := make(map[string]*Node)
+	for i := 0; i < 500; i++ {
+		key := fmt.Sprintf("user-%d", i)
+		before[key] = s.Pick(nodes, key)
+	}
+	removed := nodes[2]
+	rest := []*Node{nodes[0], nodes[1], nodes[3]}
+	for key, home := range before {
+		got := s.Pick(rest, key)
+		if home != removed && got != home {
+			t.Errorf("%s moved from %s to %s though its node stayed", key, home.ID, got.ID)
+		}
+		if got == removed {
+			t.Errorf("%s still maps to the removed node", key)
+		}
+	}
+}
+
+func TestRingHashPickDoesNotAllocate(t *testing.T) {
+	nodes := testNodes(t, 100, 50, 100)
+	s, _ := newStrategy("ring_hash")
+	s.Pick(nodes, "warm")
+	if allocs := testing.AllocsPerRun(100, func() { s.Pick(nodes, "user-1") }); allocs != 0 {
+		t.Errorf("Pick allocates %v times per call, want 0", allocs)
+	}
+}
+
+func TestLeastConnPrefersIdle(t *testing.T) {
+	nodes := testNodes(t, 100, 100, 100)
+	atomic.StoreInt32(&nodes[0].inflight, 3)
+	atomic.StoreInt32(&nodes[2].inflight, 1)
+	s, _ := newStrategy("least_conn")
+	for i := 0; i < 10; i++ {
+		if got := s.Pick(nodes, ""); got != nodes[1] {
+			t.Fatalf("pick %d = %s, want the idle node %s", i, got.ID, nodes[1].ID)
+		}
+	}
+
+	// Load is per unit of weight: 2 in flight on weight 100 beats 1 on 25.
+	nodes = testNodes(t, 100, 25)
+	atomic.StoreInt32(&nodes[0].inflight, 2)
+	atomic.StoreInt32(&nodes[1].inflight, 1)
+	if got := s.Pick(nodes, ""); got != nodes[0] {
+		t.Errorf("pick = %s, want the heavier node %s", got.ID, nodes[0].ID)
+	}
+}
+
+func TestLeastConnRotatesTies(t *testing.T) {
+	nodes := testNodes(t, 100, 100, 100)
+	s, _ := newStrategy("least_conn")
+	seen := make(map[*Node]bool)
+	for i := 0; i < len(nodes); i++ {
+		seen[s.Pick(nodes, "")] = true
+	}
+	if len(seen) != len(nodes) {
+		t.Errorf("idle ties went to %d of %d nodes", len(seen), len(nodes))
+	}
+}
+
+func TestStrategiesSkipZeroWeight(t *testing.T) {
+	for _, name := range []string{"swrr", "least_conn", "p2c_ewma", "weighted_random"} {
+		t.Run(name, func(t *testing.T) {
+			nodes := testNodes(t, 100, 100, 100)
+			atomic.StoreInt32(&nodes[1].effectiveWeight, 0)
+			s, err := newStrategy(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < 200; i++ {
+				if got := s.Pick(nodes, ""); got == nodes[1] {
+					t.Fatalf("pick %d chose the zero-weight node", i)
+				}
+			}
+		})
+	}
+}
+
+func TestP2CPrefersLowerCost(t *testing.T) {
+	nodes := testNodes(t, 100, 100)
+	atomic.StoreUint64(&nodes[0].ttfbBits, math.Float64bits(400))
+	atomic.StoreUint64(&nodes[1].ttfbBits, math.Float64bits(50))
+	s, _ := newStrategy("p2c_ewma")
+	// With two candidates a different pair is drawn almost always; the retry
+	// loop makes a same-node draw rare enough for a strict majority check.
+	fast := 0
+	for i := 0; i < 200; i++ {
+		if s.Pick(nodes, "") == nodes[1] {
+			fast++
+		}
+	}
+	if fast < 150 {
+		t.Errorf("fast node picked %d of 200 times, want most", fast)
+	}
+
+	// In-flight requests count against the fast node.
+	atomic.StoreInt32(&nodes[1].inflight, 20)
+	if c0, c1 := p2cCost(nodes[0]), p2cCost(nodes[1]); c1 <= c0 {
+		t.Errorf("busy fast node cost %v, want more than idle slow node %v", c1, c0)
+	}
+}
@@ -0,0 +1,213 @@
+package gateway
+
+import (
+	"context"
+	crand "crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	spanKindInternal = 1
+	spanKindServer   = 2
+	spanKindClient   = 3
+
+	spanStatusOK    = 1
+	spanStatusError = 2
+)
+
+// tracer is nil unless [tracing] is enabled; every span helper below is a
+// no-op in that case.
+var tracer atomic.Pointer[otlpExporter]
+
+// StartTracing starts the OTLP/HTTP exporter when tracing is enabled.
+func StartTracing(cfg TracingConfig) {
+	if !cfg.Enabled {
+		return
+	}
+	tracer.Store(newOTLPExporter(cfg))
+	Info("tracing enabled", "endpoint", cfg.Endpoint, "service", cfg.ServiceName, "sample_rate", cfg.SampleRate)
+}
+
+// ShutdownTracing sends the spans still queued and stops the exporter.
+func ShutdownTracing(ctx context.Context) {
+	exp := tracer.Swap(nil)
+	if exp == nil {
+		return
+	}
+	if err := exp.shutdown(ctx); err != nil {
+		Warn("tracing shutdown", "err", err)
+	}
+}
+
+type spanContext struct {
+	TraceID    [16]byte
+	SpanID     [8]byte
+	Sampled    bool
+	TraceState string
+}
+
+func (sc spanContext) traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + hex.EncodeToString(sc.TraceID[:]) + "-" + hex.EncodeToString(sc.SpanID[:]) + "-" + flags
+}
+
+// parseTraceparent reads a W3C traceparent header. Only version 00 fields
+// are used; unknown versions are accepted as long as the prefix parses.
+func parseTraceparent(h string) (spanContext, bool) {
+	var sc spanContext
+	parts := strings.Split(strings.TrimSpace(h), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return sc, false
+	}
+	if len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return sc, false
+	}
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return sc, false
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return sc, false
+	}
+	flags, err := strconv.ParseUint(parts[3], 16, 8)
+	if err != nil {
+		return sc, false
+	}
+	if sc.TraceID == [16]byte{} || sc.SpanID == [8]byte{} {
+		return sc, false
+	}
+	sc.Sampled = flags&1 == 1
+	return sc, true
+}
+
+type Span struct {
+	exporter *otlpExporter
+	name     string
+	kind     int
+	sc       spanContext
+	parent   [8]byte
+	start    time.Time
+
+	mu        sync.Mutex
+	attrs     []spanAttr
+	status    int
+	statusMsg string
+	ended     bool
+}
+
+type spanAttr struct {
+	Key   string
+	Value interface{}
+}
+
+type spanCtxKey struct{}
+
+func spanFromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanCtxKey{}).(*Span)
+	return s
+}
+
+// startSpan starts a child of the span in ctx, or a new root span.
+func startSpan(ctx context.Context, name string, kind int) (context.Context, *Span) {
+	exp := tracer.Load()
+	if exp == nil {
+		return ctx, nil
+	}
+	var parent *spanContext
+	if p := spanFromContext(ctx); p != nil {
+		parent = &p.sc
+	}
+	s := exp.newSpan(name, kind, parent)
+	return context.WithValue(ctx, spanCtxKey{}, s), s
+}
+
+// startServerSpan starts the span for an incoming request, continuing the
+// caller's trace when it sent a valid traceparent.
+func startServerSpan(r *http.Request, name string) (context.Context, *Span) {
+	exp := tracer.Load()
+	if exp == nil {
+		return r.Context(), nil
+	}
+	var parent *spanContext
+	if sc, ok := parseTraceparent(r.Header.Get("traceparent")); ok {
+		sc.TraceState = r.Header.Get("tracestate")
+		parent = &sc
+	}
+	s := exp.newSpan(name, spanKindServer, parent)
+	return context.WithValue(r.Context(), spanCtxKey{}, s), s
+}
+
+func (s *Span) SetAttr(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.attrs = append(s.attrs, spanAttr{Key: key, Value: value})
+	s.mu.Unlock()
+}
+
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	s.status = spanStatusError
+	s.statusMsg = err.Error()
+	s.mu.Unlock()
+}
+
+func (s *Span) SetOK() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.status == 0 {
+		s.status = spanStatusOK
+	}
+	s.mu.Unlock()
+}
+
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.mu.Unlock()
+	if s.sc.Sampled {
+		s.exporter.enqueue(s, time.Now())
+	}
+}
+
+// injectTraceContext writes traceparent/tracestate for the span onto an
+// outgoing request. Without a span the incoming headers are left untouched.
+func injectTraceContext(s *Span, h http.Header) {
+	if s == nil {
+		return
+	}
+	h.Set("traceparent", s.sc.traceparent())
+	if s.sc.TraceState != "" {
+		h.Set("tracestate", s.sc.TraceState)
+	} else {
+		h.Del("tracestate")
+	}
+}
+
+func randomID(b []byte) {
+	if _, err := crand.Read(b); err != nil {
+		binary.BigEndian.PutUint64(b[len(b)-8:], uint64(time.Now().UnixNano()))
+	}
+}
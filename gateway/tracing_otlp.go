@@ -0,0 +1,273 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// otlpExporter batches finished spans and posts them to an OTLP/HTTP
+// collector using the JSON encoding.
+type otlpExporter struct {
+	cfg     TracingConfig
+	client  *http.Client
+	queue   chan otlpSpan
+	dropped uint64
+	randMu  sync.Mutex
+	rand    *rand.Rand
+	stop    chan struct{}
+	stopped chan struct{}
+	once    sync.Once
+}
+
+func newOTLPExporter(cfg TracingConfig) *otlpExporter {
+	e := &otlpExporter{
+		cfg:     cfg,
+		client:  &http.Client{Timeout: cfg.Timeout.Duration},
+		queue:   make(chan otlpSpan, cfg.QueueSize),
+		rand:    rand.New(rand.NewSource(time.Now().UnixNano())),
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go e.run()
+	return e
+}
+
+func (e *otlpExporter) newSpan(name string, kind int, parent *spanContext) *Span {
+	s := &Span{exporter: e, name: name, kind: kind, start: time.Now()}
+	if parent != nil {
+		s.sc.TraceID = parent.TraceID
+		s.sc.Sampled = parent.Sampled
+		s.sc.TraceState = parent.TraceState
+		s.parent = parent.SpanID
+	} else {
+		randomID(s.sc.TraceID[:])
+		s.sc.Sampled = e.sample()
+	}
+	randomID(s.sc.SpanID[:])
+	return s
+}
+
+func (e *otlpExporter) sample() bool {
+	if e.cfg.SampleRate >= 1 {
+		return true
+	}
+	e.randMu.Lock()
+	defer e.randMu.Unlock()
+	return e.rand.Float64() < e.cfg.SampleRate
+}
+
+func (e *otlpExporter) enqueue(s *Span, end time.Time) {
+	s.mu.Lock()
+	span := otlpSpan{
+		TraceID:           hex.EncodeToString(s.sc.TraceID[:]),
+		SpanID:            hex.EncodeToString(s.sc.SpanID[:]),
+		TraceState:        s.sc.TraceState,
+		Name:              s.name,
+		Kind:              s.kind,
+		StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(end.UnixNano(), 10),
+		Attributes:        otlpAttributes(s.attrs),
+	}
+	if s.parent != [8]byte{} {
+		span.ParentSpanID = hex.EncodeToString(s.parent[:])
+	}
+	if s.status != 0 {
+		span.Status = &otlpStatus{Code: s.status, Message: s.statusMsg}
+	}
+	s.mu.Unlock()
+
+	select {
+	case e.queue <- span:
+	default:
+		if atomic.AddUint64(&e.dropped, 1)%1000 == 1 {
+			Warn("tracing queue full, dropping spans", "dropped", atomic.LoadUint64(&e.dropped))
+		}
+	}
+}
+
+func (e *otlpExporter) run() {
+	defer close(e.stopped)
+	ticker := time.NewTicker(e.cfg.FlushInterval.Duration)
+	defer ticker.Stop()
+	batch := make([]otlpSpan, 0, e.cfg.BatchSize)
+	for {
+		select {
+		case <-e.stop:
+			e.flush(batch)
+			return
+		case s := <-e.queue:
+			batch = append(batch, s)
+			if len(batch) < e.cfg.BatchSize {
+				continue
+			}
+		case <-ticker.C:
+			if len(batch) == 0 {
+				continue
+			}
+		}
+		if err := e.export(batch); err != nil {
+			Warn("tracing export failed", "err", err, "spans", len(batch))
+		}
+		batch = batch[:0]
+	}
+}
+
+// flush exports batch and everything still queued.
+func (e *otlpExporter) flush(batch []otlpSpan) {
+	for {
+		select {
+		case s := <-e.queue:
+			batch = append(batch, s)
+			if len(batch) < e.cfg.BatchSize {
+				continue
+			}
+		default:
+		}
+		if len(batch) == 0 {
+			return
+		}
+		if err := e.export(batch); err != nil {
+			Warn("tracing export failed", "err", err, "spans", len(batch))
+		}
+		if len(batch) < e.cfg.BatchSize {
+			return
+		}
+		batch = batch[:0]
+	}
+}
+
+// shutdown stops the exporter after sending the queued spans, or gives up
+// when ctx is done.
+func (e *otlpExporter) shutdown(ctx context.Context) error {
+	e.once.Do(func() { close(e.stop) })
+	select {
+	case <-e.stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (e *otlpExporter) export(spans []otlpSpan) error {
+	body, err := json.Marshal(otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource: otlpResource{Attributes: []otlpKeyValue{
+			{Key: "service.name", Value: otlpValue{StringValue: &e.cfg.ServiceName}},
+		}},
+		ScopeSpans: []otlpScopeSpans{{
+			Scope: otlpScope{Name: "krypton"},
+			Spans: spans,
+		}},
+	}}})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, e.cfg.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("collector returned %s", resp.Status)
+	}
+	return nil
+}
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	TraceState        string         `json:"traceState,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            *otlpStatus    `json:"status,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+}
+
+func otlpAttributes(attrs []spanAttr) []otlpKeyValue {
+	out := make([]otlpKeyValue, 0, len(attrs))
+	for _, a := range attrs {
+		var v otlpValue
+		switch x := a.Value.(type) {
+		case string:
+			v.StringValue = &x
+		case int:
+			s := strconv.Itoa(x)
+			v.IntValue = &s
+		case int32:
+			s := strconv.FormatInt(int64(x), 10)
+			v.IntValue = &s
+		case int64:
+			s := strconv.FormatInt(x, 10)
+			v.IntValue = &s
+		case float64:
+			v.DoubleValue = &x
+		case bool:
+			v.BoolValue = &x
+		default:
+			s := fmt.Sprint(x)
+			v.StringValue = &s
+		}
+		out = append(out, otlpKeyValue{Key: a.Key, Value: v})
+	}
+	return out
+}
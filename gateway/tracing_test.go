@@ -0,0 +1,221 @@
+package gateway
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	const (
+		traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+		spanID  = "00f067aa0ba902b7"
+	)
+	tests := []struct {
+		name    string
+		header  string
+		ok      bool
+		sampled bool
+	}{
+		{"sampled", "00-" + traceID + "-" + spanID + "-01", true, true},
+		{"not sampled", "00-" + traceID + "-" + spanID + "-00", true, false},
+		{"future version with extra field", "01-" + traceID + "-" + spanID + "-01-extra", true, true},
+		{"surrounding spaces", "  00-" + traceID + "-" + spanID + "-01 ", true, true},
+		{"invalid version", "ff-" + traceID + "-" + spanID + "-01", false, false},
+		{"short trace id", "00-" + traceID[:30] + "-" + spanID + "-01", false, false},
+		{"short span id", "00-" + traceID + "-" + spanID[:14] + "-01", false, false},
+		{"non-hex trace id", "00-" + strings.Repeat("z", 32) + "-" + spanID + "-01", false, false},
+		{"zero trace id", "00-" + strings.Repeat("0", 32) + "-" + spanID + "-01", false, false},
+		{"zero span id", "00-" + traceID + "-" + strings.Repeat("0", 16) + "-01", false, false},
+		{"bad flags", "00-" + traceID + "-" + spanID + "-zz", false, false},
+		{"missing fields", "00-" + traceID, false, false},
+		{"empty", "", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc, ok := parseTraceparent(tt.header)
+			if ok != tt.ok {
+				t.Fatalf("ok = %v, want %v", ok, tt.ok)
+			}
+			if !ok {
+				return
+			}
+			if got := hex.EncodeToString(sc.TraceID[:]); got != traceID {
+				t.Errorf("trace id = %s, want %s", got, traceID)
+			}
+			if got := hex.EncodeToString(sc.SpanID[:]); got != spanID {
+				t.Errorf("span id = %s, want %s", got, spanID)
+			}
+			if sc.Sampled != tt.sampled {
+				t.Errorf("sampled = %v, want %v", sc.Sampled, tt.sampled)
+			}
+		})
+	}
+}
+
+// collector is an httptest OTLP/HTTP endpoint that records every batch.
+type collector struct {
+	mu      sync.Mutex
+	batches [][]otlpSpan
+	got     chan struct{}
+}
+
+func newCollector(t *testing.T) (*collector, *httptest.Server) {
+	c := &collector{got: make(chan struct{}, 100)}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req otlpRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("decode export: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var spans []otlpSpan
+		for _, rs := range req.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				spans = append(spans, ss.Spans...)
+			}
+		}
+		c.mu.Lock()
+		c.batches = append(c.batches, spans)
+		c.mu.Unlock()
+		c.got <- struct{}{}
+	}))
+	t.Cleanup(srv.Close)
+	return c, srv
+}
+
+func (c *collector) sizes() []int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := make([]int, len(c.batches))
+	for i, b := range c.batches {
+		out[i] = len(b)
+	}
+	return out
+}
+
+func (c *collector) wait(t *testing.T, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		select {
+		case <-c.got:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("collector got %v, want %d batches", c.sizes(), n)
+		}
+	}
+}
+
+func testExporter(endpoint string, batchSize int) *otlpExporter {
+	return newOTLPExporter(TracingConfig{
+		Enabled:       true,
+		Endpoint:      endpoint,
+		ServiceName:   "krypton-test",
+		SampleRate:    1,
+		BatchSize:     batchSize,
+		QueueSize:     100,
+		FlushInterval: Duration{Duration: time.Hour},
+		Timeout:       Duration{Duration: time.Second},
+	})
+}
+
+func TestInjectTraceContext(t *testing.T) {
+	_, col := newCollector(t)
+	exp := testExporter(col.URL, 10)
+	tracer.Store(exp)
+	defer func() {
+		tracer.Store(nil)
+		_ = exp.shutdown(context.Background())
+	}()
+
+	var upstream http.Header
+	up := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		upstream = r.Header.Clone()
+	}))
+	defer up.Close()
+
+	const parent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	in := httptest.NewRequest(http.MethodGet, "http://gateway/v1/models", nil)
+	in.Header.Set("traceparent", parent)
+	in.Header.Set("tracestate", "vendor=1")
+	ctx, server := startServerSpan(in, "krypton.request")
+	_, client := startSpan(ctx, "krypton.upstream_attempt", spanKindClient)
+
+	out, err := http.NewRequest(http.MethodGet, up.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out.Header.Set("traceparent", parent)
+	injectTraceContext(client, out.Header)
+	resp, err := http.DefaultClient.Do(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	client.End()
+	server.End()
+
+	sc, ok := parseTraceparent(upstream.Get("traceparent"))
+	if !ok {
+		t.Fatalf("upstream traceparent %q does not parse", upstream.Get("traceparent"))
+	}
+	if got := hex.EncodeToString(sc.TraceID[:]); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("trace id = %s, want the caller's", got)
+	}
+	if sc.SpanID != client.sc.SpanID {
+		t.Errorf("span id = %x, want the attempt span %x", sc.SpanID, client.sc.SpanID)
+	}
+	if client.parent != server.sc.SpanID || server.parent == [8]byte{} {
+		t.Error("attempt span is not a child of the server span")
+	}
+	if !sc.Sampled {
+		t.Error("sampled flag lost")
+	}
+	if got := upstream.Get("tracestate"); got != "vendor=1" {
+		t.Errorf("tracestate = %q, want vendor=1", got)
+	}
+
+	// Without a span the caller's headers pass through untouched.
+	h := http.Header{}
+	h.Set("traceparent", parent)
+	injectTraceContext(nil, h)
+	if h.Get("traceparent") != parent {
+		t.Errorf("traceparent changed without a span: %q", h.Get("traceparent"))
+	}
+}
+
+func TestOTLPExporterBatching(t *testing.T) {
+	col, srv := newCollector(t)
+	exp := testExporter(srv.URL, 3)
+
+	for i := 0; i < 7; i++ {
+		exp.newSpan("span", spanKindInternal, nil).End()
+	}
+	// Two full batches go out at once; the last span waits for the
+	// flush interval.
+	col.wait(t, 2)
+	if got := col.sizes(); len(got) != 2 || got[0] != 3 || got[1] != 3 {
+		t.Fatalf("batches = %v, want [3 3]", got)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := exp.shutdown(ctx); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+	if got := col.sizes(); len(got) != 3 || got[2] != 1 {
+		t.Fatalf("batches after shutdown = %v, want [3 3 1]", got)
+	}
+
+	col.mu.Lock()
+	first := col.batches[0][0]
+	col.mu.Unlock()
+	if len(first.TraceID) != 32 || len(first.SpanID) != 16 || first.Name != "span" {
+		t.Errorf("unexpected span %+v", first)
+	}
+}
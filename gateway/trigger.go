@@ -10,11 +10,11 @@ import (
 )
 
 type TriggerResult struct {
-	Score   *int32
-	Penalty *int32
-	Reward  *int32
-	Retry   *bool
-	Message string
+	Score   *int32 `json:"score,omitempty"`
+	Penalty *int32 `json:"penalty,omitempty"`
+	Reward  *int32 `json:"reward,omitempty"`
+	Retry   *bool  `json:"retry,omitempty"`
+	Message string `json:"message,omitempty"`
 }
 
 func runTrigger(ctx context.Context, cfg *Config, node *Node, req *triggerRequest, resp *triggerResponse) (*TriggerResult, error) {
@@ -31,6 +31,7 @@ func runTrigger(ctx context.Context, cfg *Config, node *Node, req *triggerReques
 	}
 
 	thread := &starlark.Thread{Name: "trigger_check"}
+	attachScriptLog(ctx, thread)
 	done := make(chan error, 1)
 	var result *TriggerResult
 
@@ -79,14 +80,14 @@ func runTrigger(ctx context.Context, cfg *Config, node *Node, req *triggerReques
 }
 
 type triggerRequest struct {
-	Method  string
-	Path    string
-	Headers map[string]string
+	Method  string            `json:"method"`
+	Path    string            `json:"path"`
+	Headers map[string]string `json:"headers"`
 }
 
 type triggerResponse struct {
-	Status int
-	Body   string
+	Status int    `json:"status"`
+	Body   string `json:"body"`
 }
 
 func (t *triggerRequest) toDict() *starlark.Dict {
@@ -0,0 +1,217 @@
+(function () {
+  "use strict";
+
+  var HISTORY = 300;
+  var FEED = 100;
+  var history = {};
+  var nodes = {};
+  var token = sessionStorage.getItem("krypton-token") || "";
+  var generation = 0;
+
+  var $ = function (id) { return document.getElementById(id); };
+
+  $("token").value = token;
+  $("login").addEventListener("submit", function (e) {
+    e.preventDefault();
+    token = $("token").value;
+    sessionStorage.setItem("krypton-token", token);
+    connect();
+  });
+
+  function setConn(ok, text) {
+    var el = $("conn");
+    el.className = "pill " + (ok ? "on" : "off");
+    el.textContent = text;
+  }
+
+  function connect() {
+    if (!token) {
+      setConn(false, "token required");
+      return;
+    }
+    var gen = ++generation;
+    setConn(false, "connecting");
+    fetch("/.krypton/events", { headers: { "X-Krypton-Token": token } }).then(function (res) {
+      if (!res.ok) {
+        throw new Error("HTTP " + res.status);
+      }
+      setConn(true, "live");
+      return read(res.body.getReader(), gen);
+    }).catch(function (err) {
+      setConn(false, String(err.message || err));
+    }).then(function () {
+      if (gen === generation) {
+        setTimeout(function () { if (gen === generation) connect(); }, 3000);
+      }
+    });
+  }
+
+  function read(reader, gen) {
+    var decoder = new TextDecoder();
+    var buf = "";
+    function pump() {
+      return reader.read().then(function (r) {
+        if (r.done || gen !== generation) {
+          reader.cancel();
+          setConn(false, "disconnected");
+          return;
+        }
+        buf += decoder.decode(r.value, { stream: true });
+        var idx;
+        while ((idx = buf.indexOf("\n\n")) >= 0) {
+          dispatch(buf.slice(0, idx));
+          buf = buf.slice(idx + 2);
+        }
+        return pump();
+      });
+    }
+    return pump();
+  }
+
+  function dispatch(chunk) {
+    var type = "message";
+    var data = "";
+    chunk.split("\n").forEach(function (line) {
+      if (line.indexOf("event: ") === 0) type = line.slice(7);
+      else if (line.indexOf("data: ") === 0) data += line.slice(6);
+    });
+    if (!data) return;
+    var msg = JSON.parse(data);
+    if (type === "status") onStatus(msg);
+    else if (type === "node") onNode(msg);
+    else if (type === "health") onHealth(msg);
+    else if (type === "retry") onRetry(msg);
+  }
+
+  function record(id, t, n) {
+    var h = history[id] || (history[id] = []);
+    h.push({
+      t: t,
+      ew: n.initial_weight > 0 ? 100 * n.effective_weight / n.initial_weight : 0,
+      ps: n.passive_score,
+      as: n.active_score
+    });
+    if (h.length > HISTORY) h.splice(0, h.length - HISTORY);
+  }
+
+  function onStatus(st) {
+    var seen = {};
+    var t = Date.parse(st.time);
+    st.nodes.forEach(function (n) {
+      seen[n.id] = true;
+      nodes[n.id] = n;
+      record(n.id, t, n);
+    });
+    Object.keys(nodes).forEach(function (id) {
+      if (!seen[id]) {
+        delete nodes[id];
+        delete history[id];
+      }
+    });
+    renderSummary(st);
+    renderNodes();
+  }
+
+  function onNode(ev) {
+    var n = nodes[ev.node];
+    if (!n) return;
+    n.effective_weight = ev.data.effective_weight;
+    n.passive_score = ev.data.passive_score;
+    n.active_score = ev.data.active_score;
+    n.inflight = ev.data.inflight;
+    n.state = ev.data.state;
+    record(ev.node, Date.parse(ev.time), n);
+    renderNodes();
+  }
+
+  function onHealth(ev) {
+    var d = ev.data;
+    var cls = d.error ? "bad" : (d.status === "healthy" ? "" : "warn");
+    var text = ev.node + " score=" + d.score + " status=" + d.status + " " + d.duration_ms + "ms";
+    if (d.message) text += " " + d.message;
+    if (d.error) text += " err=" + d.error;
+    if (nodes[ev.node]) nodes[ev.node].last_health = d;
+    prepend("health", ev.time, text, cls);
+  }
+
+  function onRetry(ev) {
+    var d = ev.data;
+    var text = ev.node + " " + d.method + " " + d.path + " attempt=" + d.attempt + "/" + d.total + " reason=" + d.reason + " id=" + d.request_id;
+    prepend("retries", ev.time, text, "warn");
+  }
+
+  function prepend(listId, time, text, cls) {
+    var ul = $(listId);
+    var li = document.createElement("li");
+    var ts = document.createElement("span");
+    ts.className = "t";
+    ts.textContent = new Date(time).toLocaleTimeString();
+    li.appendChild(ts);
+    var body = document.createElement("span");
+    body.textContent = text;
+    if (cls) body.className = cls;
+    li.appendChild(body);
+    ul.insertBefore(li, ul.firstChild);
+    while (ul.children.length > FEED) ul.removeChild(ul.lastChild);
+  }
+
+  function card(label, value) {
+    return "<div class=\"card\">" + esc(label) + "<b>" + esc(String(value)) + "</b></div>";
+  }
+
+  function renderSummary(st) {
+    $("summary").innerHTML =
+      card("Nodes", st.node_count) +
+      card("Shards", st.shards) +
+      card("In-flight", st.total_inflight) +
+      card("Effective weight", st.total_effective_weight);
+  }
+
+  function renderNodes() {
+    var ids = Object.keys(nodes).sort();
+    var rows = ids.map(function (id) {
+      var n = nodes[id];
+      var lh = n.last_health;
+      var check = lh ? (lh.status + " (" + lh.score + ")") : "-";
+      var weight = n.effective_weight + " / " + n.initial_weight;
+      if (n.override) weight += " *";
+      return "<tr>" +
+        "<td>" + esc(id) + "</td>" +
+        "<td class=\"state-" + esc(n.state) + "\">" + esc(n.state) + "</td>" +
+        "<td>" + n.bucket + "</td>" +
+        "<td>" + esc(weight) + "</td>" +
+        "<td>" + n.passive_score + "</td>" +
+        "<td>" + n.active_score + "</td>" +
+        "<td>" + n.inflight + "</td>" +
+        "<td>" + esc(check) + "</td>" +
+        "<td>" + chart(history[id] || []) + "</td>" +
+        "</tr>";
+    });
+    document.querySelector("#nodes tbody").innerHTML = rows.join("");
+  }
+
+  function chart(points) {
+    var w = 240, h = 40;
+    if (points.length < 2) return "<svg width=\"" + w + "\" height=\"" + h + "\"></svg>";
+    var t0 = points[0].t, t1 = points[points.length - 1].t || t0 + 1;
+    var span = Math.max(t1 - t0, 1);
+    function line(key, color) {
+      var pts = points.map(function (p) {
+        var x = (p.t - t0) / span * w;
+        var y = h - 2 - (Math.max(0, Math.min(100, p[key])) / 100) * (h - 4);
+        return x.toFixed(1) + "," + y.toFixed(1);
+      });
+      return "<polyline fill=\"none\" stroke=\"" + color + "\" stroke-width=\"1.5\" points=\"" + pts.join(" ") + "\"/>";
+    }
+    return "<svg width=\"" + w + "\" height=\"" + h + "\">" +
+      line("as", "#f472b6") + line("ps", "#38bdf8") + line("ew", "#a78bfa") + "</svg>";
+  }
+
+  function esc(s) {
+    return String(s).replace(/[&<>"']/g, function (c) {
+      return { "&": "&amp;", "<": "&lt;", ">": "&gt;", "\"": "&quot;", "'": "&#39;" }[c];
+    });
+  }
+
+  connect();
+})();
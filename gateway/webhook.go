@@ -0,0 +1,311 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	webhookNodeClass    = "node_class"
+	webhookHealthStatus = "health_status"
+	webhookNodeState    = "node_state"
+
+	classHealthy  = "healthy"
+	classDegraded = "degraded"
+	classEjected  = "ejected"
+
+	webhookQueueSize = 1024
+)
+
+// WebhookEvent is the JSON body posted to every matching webhook.
+type WebhookEvent struct {
+	Type   string        `json:"type"`
+	Time   time.Time     `json:"time"`
+	Node   string        `json:"node"`
+	From   string        `json:"from"`
+	To     string        `json:"to"`
+	State  *NodeEvent    `json:"node_state,omitempty"`
+	Health *HealthRecord `json:"health,omitempty"`
+}
+
+// Notifier watches the balancer event feed and posts a webhook whenever a
+// node moves between weight classes, changes state, or its health check
+// status changes. It only subscribes while webhooks are configured, and a
+// config reload starts or stops it. Events arrive through a queue
+// subscription so no transition is missed, and a single worker delivers
+// them in order.
+type Notifier struct {
+	balancer *Balancer
+	client   *http.Client
+
+	mu     sync.Mutex
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// notifyRun is the state of one started notifier; a stop and a quick
+// restart never share it.
+type notifyRun struct {
+	n          *Notifier
+	deliveries chan webhookDelivery
+	class      map[string]string
+	state      map[string]string
+	health     map[string]string
+}
+
+type webhookDelivery struct {
+	hook  WebhookConfig
+	event WebhookEvent
+	body  []byte
+}
+
+func NewNotifier(balancer *Balancer) *Notifier {
+	return &Notifier{
+		balancer: balancer,
+		client:   &http.Client{},
+	}
+}
+
+// Run registers the notifier with the balancer and keeps it in step with
+// the configured webhooks until ctx is cancelled.
+func (n *Notifier) Run(ctx context.Context) {
+	n.mu.Lock()
+	n.ctx = ctx
+	n.mu.Unlock()
+
+	b := n.balancer
+	b.cfgMu.Lock()
+	b.notifier = n
+	n.setEnabled(len(b.config.Notify.Webhooks) > 0)
+	b.cfgMu.Unlock()
+
+	<-ctx.Done()
+}
+
+// setEnabled starts or stops the event subscription. It is called with
+// cfgMu held, so it never waits for a stopping run to finish.
+func (n *Notifier) setEnabled(enabled bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.ctx == nil || n.ctx.Err() != nil || enabled == (n.cancel != nil) {
+		return
+	}
+	if !enabled {
+		n.cancel()
+		n.cancel = nil
+		Info("webhook notifier stopped")
+		return
+	}
+	ctx, cancel := context.WithCancel(n.ctx)
+	n.cancel = cancel
+	run := &notifyRun{
+		n:          n,
+		deliveries: make(chan webhookDelivery, webhookQueueSize),
+		class:      make(map[string]string),
+		state:      make(map[string]string),
+		health:     make(map[string]string),
+	}
+	go run.run(ctx)
+	Info("webhook notifier started")
+}
+
+// run consumes events until ctx is cancelled, which also stops delivery.
+func (r *notifyRun) run(ctx context.Context) {
+	q := r.n.balancer.events.SubscribeQueue()
+	defer r.n.balancer.events.UnsubscribeQueue(q)
+	go r.deliverLoop(ctx)
+
+	cfg := r.n.notifyConfig()
+	for _, st := range r.n.balancer.Status().Nodes {
+		r.class[st.ID] = cfg.classify(st.EffectiveWeight, st.InitialWeight)
+		r.state[st.ID] = st.State
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-q.Wait():
+			events, dropped := q.Drain()
+			if dropped > 0 {
+				Warn("notifier fell behind, events dropped", "dropped", dropped)
+			}
+			cfg := r.n.notifyConfig()
+			for _, ev := range events {
+				r.handle(cfg, ev)
+			}
+			r.prune()
+		}
+	}
+}
+
+// notifySettings is the part of the config the notifier reads, copied
+// under cfgMu so a concurrent reload cannot tear it.
+type notifySettings struct {
+	NotifyConfig
+	minWeight int32
+}
+
+func (n *Notifier) notifyConfig() notifySettings {
+	b := n.balancer
+	b.cfgMu.RLock()
+	defer b.cfgMu.RUnlock()
+	return notifySettings{NotifyConfig: b.config.Notify, minWeight: b.config.Strategy.MinWeight}
+}
+
+// prune forgets nodes that are no longer configured.
+func (r *notifyRun) prune() {
+	for _, m := range []map[string]string{r.class, r.state, r.health} {
+		for id := range m {
+			if r.n.balancer.Node(id) == nil {
+				delete(m, id)
+			}
+		}
+	}
+}
+
+func (r *notifyRun) handle(cfg notifySettings, ev Event) {
+	switch data := ev.Data.(type) {
+	case NodeEvent:
+		class := cfg.classify(data.EffectiveWeight, data.InitialWeight)
+		if prev := r.classOf(ev.Node); prev != class {
+			r.class[ev.Node] = class
+			r.notify(cfg, WebhookEvent{Type: webhookNodeClass, Time: ev.Time, Node: ev.Node, From: prev, To: class, State: &data})
+		}
+		prevState, ok := r.state[ev.Node]
+		if !ok {
+			prevState = NodeEnabled.String()
+		}
+		if prevState != data.State {
+			r.state[ev.Node] = data.State
+			r.notify(cfg, WebhookEvent{Type: webhookNodeState, Time: ev.Time, Node: ev.Node, From: prevState, To: data.State, State: &data})
+		}
+	case *HealthRecord:
+		prev, ok := r.health[ev.Node]
+		r.health[ev.Node] = data.Status
+		if (ok && prev != data.Status) || (!ok && data.Status != classHealthy) {
+			r.notify(cfg, WebhookEvent{Type: webhookHealthStatus, Time: ev.Time, Node: ev.Node, From: prev, To: data.Status, Health: data})
+		}
+	}
+}
+
+func (r *notifyRun) classOf(id string) string {
+	if c, ok := r.class[id]; ok {
+		return c
+	}
+	return classHealthy
+}
+
+// classify maps a node's weight to healthy, degraded (below
+// degraded_ratio of its configured weight) or ejected (pushed down to
+// min_weight). A node configured at or below min_weight is only ejected
+// once its weight reaches zero.
+func (cfg notifySettings) classify(effective, initial int32) string {
+	if effective <= 0 || (initial > cfg.minWeight && effective <= cfg.minWeight) {
+		return classEjected
+	}
+	if initial > 0 && float64(effective)/float64(initial) < cfg.DegradedRatio {
+		return classDegraded
+	}
+	return classHealthy
+}
+
+func (r *notifyRun) notify(cfg notifySettings, ev WebhookEvent) {
+	Info("node transition", "type", ev.Type, "node", ev.Node, "from", ev.From, "to", ev.To)
+	body, err := json.Marshal(ev)
+	if err != nil {
+		Error("webhook encode failed", "type", ev.Type, "err", err)
+		return
+	}
+	for _, wh := range cfg.Webhooks {
+		if !wh.wants(ev.Type) {
+			continue
+		}
+		select {
+		case r.deliveries <- webhookDelivery{hook: wh, event: ev, body: body}:
+		default:
+			Warn("webhook queue full, dropping event", "url", redactURL(wh.URL), "type", ev.Type, "node", ev.Node)
+		}
+	}
+}
+
+func (r *notifyRun) deliverLoop(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case d := <-r.deliveries:
+			r.n.deliver(ctx, d.hook, d.event, d.body)
+		}
+	}
+}
+
+func (wh WebhookConfig) wants(eventType string) bool {
+	if len(wh.Events) == 0 {
+		return true
+	}
+	for _, e := range wh.Events {
+		if e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// deliver posts body to one webhook, retrying with exponential backoff on
+// transport errors and non-2xx responses.
+func (n *Notifier) deliver(ctx context.Context, wh WebhookConfig, ev WebhookEvent, body []byte) {
+	backoff := wh.RetryBackoff.Duration
+	var err error
+	for attempt := 0; attempt <= wh.MaxRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+		if err = n.post(ctx, wh, body); err == nil {
+			return
+		}
+		Warn("webhook delivery failed", "url", redactURL(wh.URL), "type", ev.Type, "node", ev.Node, "attempt", attempt+1, "err", err)
+	}
+	Error("webhook gave up", "url", redactURL(wh.URL), "type", ev.Type, "node", ev.Node, "err", err)
+}
+
+func (n *Notifier) post(ctx context.Context, wh WebhookConfig, body []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, wh.Timeout.Duration)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, wh.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "krypton")
+	for k, v := range wh.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := n.client.Do(req)
+	if err != nil {
+		// *url.Error repeats the full URL; keep only the cause.
+		var ue *url.Error
+		if errors.As(err, &ue) {
+			return ue.Err
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
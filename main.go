@@ -2,7 +2,12 @@ package main
 
 import (
 	"context"
+	"errors"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"krypton/gateway"
@@ -11,31 +16,65 @@ import (
 func main() {
 	cfg, err := gateway.LoadConfig("config.toml")
 	if err != nil {
-		gateway.Errorf("load config: %v", err)
+		gateway.Error("load config failed", "err", err)
 		return
 	}
 
+	if err := gateway.SetLogFormat(cfg.Gateway.LogFormat); err != nil {
+		gateway.Warn("ignoring gateway.log_format", "err", err)
+	}
+	gateway.SetLogFormatFromEnv()
 	gateway.SetLogLevelFromEnv()
+	gateway.WatchLogSignals()
+	gateway.StartTracing(cfg.Tracing)
 
 	balancer, err := gateway.NewBalancer(cfg)
 	if err != nil {
-		gateway.Errorf("init balancer: %v", err)
+		gateway.Error("init balancer failed", "err", err)
 		return
 	}
 
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	health := gateway.NewHealthChecker(cfg, balancer)
-	go health.Run(context.Background())
+	go health.Run(ctx)
+	go gateway.NewNotifier(balancer).Run(ctx)
+	go balancer.RunLatencyScores(ctx)
 
 	var handler http.Handler = balancer
+	var adminServer *http.Server
 	if cfg.Gateway.AdminAPIEnabled {
-		if cfg.Gateway.AdminAPIToken == "" {
-			gateway.Errorf("admin_api_enabled requires admin_api_token")
-			return
+		if cfg.Gateway.AdminAPIToken == "" && len(cfg.Gateway.AdminTokens) == 0 {
+			gateway.Error("admin_api_enabled requires admin_api_token or admin_tokens")
+			os.Exit(1)
+		}
+		admin := gateway.NewAdminHandler("config.toml", balancer)
+		if cfg.Gateway.AdminListen != "" {
+			adminServer, err = gateway.NewAdminServer(cfg, admin)
+			if err != nil {
+				gateway.Error("init admin server failed", "err", err)
+				os.Exit(1)
+			}
+			// Bind before serving so a busy admin port stops startup
+			// instead of leaving the gateway without admin access.
+			ln, err := net.Listen("tcp", cfg.Gateway.AdminListen)
+			if err != nil {
+				gateway.Error("admin listen failed", "addr", cfg.Gateway.AdminListen, "err", err)
+				os.Exit(1)
+			}
+			go func() {
+				gateway.Info("krypton admin listening", "addr", cfg.Gateway.AdminListen)
+				if err := gateway.ServeAdmin(adminServer, ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+					gateway.Error("admin server stopped", "err", err)
+				}
+			}()
+		} else {
+			mux := http.NewServeMux()
+			mux.Handle("/", balancer)
+			mux.Handle("/.krypton/", admin)
+			handler = mux
 		}
-		mux := http.NewServeMux()
-		mux.Handle("/", balancer)
-		mux.Handle("/.krypton/", gateway.NewAdminHandler("config.toml", balancer))
-		handler = mux
 	}
 
 	server := &http.Server{
@@ -47,8 +86,28 @@ func main() {
 		IdleTimeout:       cfg.Gateway.IdleTimeout.Duration,
 	}
 
-	gateway.Infof("krypton listening on %s", cfg.Gateway.Listen)
-	if err := server.ListenAndServe(); err != nil {
-		gateway.Errorf("server: %v", err)
+	shutdownDone := make(chan struct{})
+	go func() {
+		defer close(shutdownDone)
+		<-ctx.Done()
+		gateway.Info("krypton shutting down")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			gateway.Warn("server shutdown", "err", err)
+		}
+		if adminServer != nil {
+			if err := adminServer.Shutdown(shutdownCtx); err != nil {
+				gateway.Warn("admin server shutdown", "err", err)
+			}
+		}
+		gateway.ShutdownTracing(shutdownCtx)
+	}()
+
+	gateway.Info("krypton listening", "addr", cfg.Gateway.Listen)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		gateway.Error("server stopped", "err", err)
+		return
 	}
+	<-shutdownDone
 }